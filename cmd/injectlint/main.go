@@ -0,0 +1,481 @@
+// injectlint 静态检查包中结构体的注入 tag 定义: 未注册的 tag, by/from 引用不存在的字段, default/enum 等用在不支持的字段类型上.
+// resolver 签名是否匹配只能在运行时判断, 需要在测试中调用 injector.Verify 检查.
+// 运行时通过 RegisterAliasInjection 注册的别名用 -alias 传入, 检查时按别名展开.
+//
+//	injectlint [-tag inject] [-tags custom1,custom2] [-alias name=tags ...] [dir ...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/peterq/web-artisan/injector"
+)
+
+var (
+	tagName    = flag.String("tag", "inject", "struct tag name used by the injector")
+	customTags = flag.String("tags", "", "comma separated custom tags and aliases registered at runtime")
+	aliases    = aliasFlag{}
+)
+
+func init() {
+	flag.Var(aliases, "alias", "alias registered at runtime in the form name=tags, can be repeated")
+}
+
+var regUseResolver = regexp.MustCompile(`^@(\w+):`)
+
+// 别名最多展开的层数, 避免循环引用
+const maxAliasDepth = 8
+
+type aliasFlag map[string]string
+
+func (a aliasFlag) String() string {
+	var list []string
+	for name, tags := range a {
+		list = append(list, name+"="+tags)
+	}
+	return strings.Join(list, " ")
+}
+
+func (a aliasFlag) Set(v string) error {
+	vals := strings.SplitN(v, "=", 2)
+	if len(vals) != 2 || vals[0] == "" || vals[1] == "" {
+		return fmt.Errorf("alias must be in the form name=tags: %q", v)
+	}
+	a[vals[0]] = vals[1]
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	l := newLinter(*tagName, strings.Split(*customTags, ","), aliases)
+	var problems []string
+	for _, dir := range dirs {
+		p, err := l.lintDir(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		problems = append(problems, p...)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+type linter struct {
+	tagName string
+	known   map[string]bool
+	aliases map[string]string
+}
+
+func newLinter(tagName string, custom []string, aliases map[string]string) *linter {
+	l := &linter{tagName: tagName, known: map[string]bool{}, aliases: aliases}
+	for _, name := range injector.BakedInTagNames() {
+		l.known[name] = true
+	}
+	for _, name := range custom {
+		if name = strings.TrimSpace(name); name != "" {
+			l.known[name] = true
+		}
+	}
+	return l
+}
+
+// 类型声明的作用域, 函数内声明的同名类型互不影响
+type scope struct {
+	parent  *scope
+	structs map[string]*ast.StructType
+	named   map[string]ast.Expr // 非结构体的具名类型和类型别名
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, structs: map[string]*ast.StructType{}, named: map[string]ast.Expr{}}
+}
+
+func (sc *scope) declare(spec *ast.TypeSpec) {
+	if st, ok := spec.Type.(*ast.StructType); ok {
+		sc.structs[spec.Name.Name] = st
+	} else {
+		sc.named[spec.Name.Name] = spec.Type
+	}
+}
+
+func (sc *scope) lookup(name string) (*ast.StructType, ast.Expr, bool) {
+	for ; sc != nil; sc = sc.parent {
+		if st, ok := sc.structs[name]; ok {
+			return st, nil, true
+		}
+		if expr, ok := sc.named[name]; ok {
+			return nil, expr, true
+		}
+	}
+	return nil, nil, false
+}
+
+// 沿具名类型和别名找到结构体定义, 无法确定时返回 nil
+func (sc *scope) resolveStruct(expr ast.Expr) *ast.StructType {
+	for depth := 0; depth < maxAliasDepth; depth++ {
+		switch t := expr.(type) {
+		case *ast.StructType:
+			return t
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.Ident:
+			st, named, ok := sc.lookup(t.Name)
+			if !ok {
+				return nil
+			}
+			if st != nil {
+				return st
+			}
+			expr = named
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+type pkgLint struct {
+	*linter
+	fset     *token.FileSet
+	problems []string
+}
+
+func (l *linter) lintDir(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &pkgLint{linter: l, fset: token.NewFileSet()}
+	top := newScope(nil)
+	var parsed []*ast.File
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(pkg.fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+		for _, spec := range typeSpecs(f.Decls) {
+			top.declare(spec)
+		}
+	}
+
+	for _, f := range parsed {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range typeSpecs([]ast.Decl{d}) {
+					pkg.lintSpec(spec, top)
+				}
+			case *ast.FuncDecl:
+				if d.Body != nil {
+					pkg.lintBlock(d.Body.List, top)
+				}
+			}
+		}
+	}
+	return pkg.problems, nil
+}
+
+func typeSpecs(decls []ast.Decl) []*ast.TypeSpec {
+	var specs []*ast.TypeSpec
+	for _, decl := range decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			specs = append(specs, spec.(*ast.TypeSpec))
+		}
+	}
+	return specs
+}
+
+// 检查语句块中声明的类型, 嵌套的语句块使用新的作用域
+func (pkg *pkgLint) lintBlock(stmts []ast.Stmt, parent *scope) {
+	sc := newScope(parent)
+	var decls []ast.Decl
+	for _, stmt := range stmts {
+		if d, ok := stmt.(*ast.DeclStmt); ok {
+			decls = append(decls, d.Decl)
+		}
+	}
+	specs := typeSpecs(decls)
+	for _, spec := range specs {
+		sc.declare(spec)
+	}
+	for _, spec := range specs {
+		pkg.lintSpec(spec, sc)
+	}
+
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*ast.DeclStmt); ok {
+			continue
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch b := n.(type) {
+			case *ast.BlockStmt:
+				pkg.lintBlock(b.List, sc)
+				return false
+			case *ast.CaseClause:
+				pkg.lintBlock(b.Body, sc)
+				return false
+			case *ast.CommClause:
+				pkg.lintBlock(b.Body, sc)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+func (pkg *pkgLint) lintSpec(spec *ast.TypeSpec, sc *scope) {
+	if st, ok := spec.Type.(*ast.StructType); ok {
+		pkg.lintStruct(spec.Name.Name, st, sc)
+	}
+}
+
+func (pkg *pkgLint) lintStruct(structName string, st *ast.StructType, sc *scope) {
+	for _, field := range st.Fields.List {
+		if field.Tag == nil || len(field.Names) == 0 {
+			continue
+		}
+		raw, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			continue
+		}
+		tag := reflect.StructTag(raw).Get(pkg.tagName)
+		if tag == "" || tag == "-" {
+			continue
+		}
+		for _, fieldName := range field.Names {
+			report := func(format string, args ...interface{}) {
+				pkg.problems = append(pkg.problems, fmt.Sprintf("%s: %s.%s: %s", pkg.fset.Position(field.Pos()), structName, fieldName.Name, fmt.Sprintf(format, args...)))
+			}
+			// dive 之后的 tag 作用于元素类型, 无法确定时为 nil
+			typ := field.Type
+			for _, group := range pkg.expand(tag, 0, report) {
+				for _, item := range group {
+					if item.Name == "" {
+						report("empty tag in %q", tag)
+						continue
+					}
+					if !pkg.known[item.Name] {
+						report("unknown tag %q", item.Name)
+						continue
+					}
+					if item.Name == "dive" {
+						elem := elemType(typ, sc)
+						if elem == nil && typ != nil {
+							if k := kind(derefType(typ), sc); k != "" && k != "interface" {
+								report("dive not supported for %s", k)
+							}
+						}
+						typ = elem
+						continue
+					}
+					if typ != nil {
+						pkg.lintParam(st, typ, item.Name, item.Param, sc, report)
+					}
+				}
+			}
+		}
+	}
+}
+
+// 按 injector 的规则拆分 tag 并展开别名
+func (pkg *pkgLint) expand(tag string, depth int, report func(format string, args ...interface{})) [][]injector.TagItem {
+	var groups [][]injector.TagItem
+	split := injector.SplitTag(tag)
+	for i, t := range strings.Split(tag, ";") {
+		if aliasTags, ok := pkg.aliases[t]; ok {
+			if depth >= maxAliasDepth {
+				report("alias %q nested too deep", t)
+				continue
+			}
+			groups = append(groups, pkg.expand(aliasTags, depth+1, report)...)
+			continue
+		}
+		groups = append(groups, split[i])
+	}
+	return groups
+}
+
+// 去掉指针
+func derefType(typ ast.Expr) ast.Expr {
+	for {
+		star, ok := typ.(*ast.StarExpr)
+		if !ok {
+			return typ
+		}
+		typ = star.X
+	}
+}
+
+// 切片, 数组的元素类型或 map 的值类型
+func elemType(typ ast.Expr, sc *scope) ast.Expr {
+	for depth := 0; typ != nil && depth < maxAliasDepth; depth++ {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ArrayType:
+			return t.Elt
+		case *ast.MapType:
+			return t.Value
+		case *ast.Ident:
+			_, named, _ := sc.lookup(t.Name)
+			typ = named
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (pkg *pkgLint) lintParam(st *ast.StructType, typ ast.Expr, name string, param string, sc *scope, report func(format string, args ...interface{})) {
+	switch name {
+	case "by":
+		for regUseResolver.MatchString(param) {
+			param = regUseResolver.ReplaceAllString(param, "")
+		}
+		for _, ref := range strings.Split(param, ",") {
+			if !hasField(st, ref, sc) {
+				report("by references missing field %q", ref)
+			}
+		}
+	case "enum":
+		if k := kind(typ, sc); k != "" && k != "string" {
+			report("enum not supported for %s", k)
+		}
+	case "from":
+		if ref := strings.SplitN(param, ",", 2)[0]; !hasField(st, ref, sc) {
+			report("from references missing field %q", ref)
+		}
+	case "regex", "email", "url":
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if k := kind(typ, sc); k != "" && k != "string" {
+			report("%s not supported for %s", name, k)
+		}
+	case "min", "max", "len":
+		if param == "" {
+			report("%s tag need a param", name)
+		}
+		if k := kind(typ, sc); k == "struct" || k == "interface" || k == "bool" {
+			report("%s not supported for %s", name, k)
+		}
+	case "default":
+		if param == "" {
+			report("default tag need a param")
+		}
+		if k := kind(typ, sc); k != "" && k != "string" && !strings.HasPrefix(k, "int") && !strings.HasPrefix(k, "uint") {
+			report("default not supported for %s", k)
+		}
+	}
+}
+
+// 检查嵌套字段是否存在, 无法确定的外部类型视为存在
+func hasField(st *ast.StructType, nested string, sc *scope) bool {
+	parts := strings.Split(nested, ".")
+	for i, part := range parts {
+		if idx := strings.Index(part, "["); idx != -1 {
+			part = part[:idx]
+		}
+		var found ast.Expr
+		for _, field := range st.Fields.List {
+			for _, name := range field.Names {
+				if name.Name == part {
+					found = field.Type
+				}
+			}
+			if len(field.Names) == 0 && embeddedName(field.Type) == part {
+				found = field.Type
+			}
+		}
+		if found == nil {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		if st = sc.resolveStruct(found); st == nil {
+			return true
+		}
+	}
+	return true
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// 字段的基础类型名称, 无法确定时返回空字符串
+func kind(expr ast.Expr, sc *scope) string {
+	for depth := 0; depth < maxAliasDepth; depth++ {
+		switch t := expr.(type) {
+		case *ast.Ident:
+			st, named, ok := sc.lookup(t.Name)
+			if !ok {
+				// 内置类型
+				if obj, ok := types.Universe.Lookup(t.Name).(*types.TypeName); ok {
+					if types.IsInterface(obj.Type()) {
+						return "interface"
+					}
+					return obj.Type().Underlying().String()
+				}
+				return ""
+			}
+			if st != nil {
+				return "struct"
+			}
+			expr = named
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.StarExpr:
+			return "ptr"
+		case *ast.ArrayType:
+			return "slice"
+		case *ast.MapType:
+			return "map"
+		case *ast.StructType:
+			return "struct"
+		case *ast.InterfaceType:
+			return "interface"
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// testdata 下每个目录是一个包, 检查结果与同名的 .golden 文件比较
+func TestLintGolden(t *testing.T) {
+	l := newLinter("inject", nil, map[string]string{
+		"role": "enum=admin,member",
+	})
+	dirs, err := filepath.Glob(filepath.Join("testdata", "*"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			problems, err := l.lintDir(dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := strings.Join(problems, "\n") + "\n"
+			golden := dir + ".golden"
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, []byte(got), 0644))
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
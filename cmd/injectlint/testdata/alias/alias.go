@@ -0,0 +1,18 @@
+package alias
+
+type Level = int
+
+type base struct {
+	Age int
+}
+
+type Base = base
+
+type input struct {
+	Role  string `inject:"role"`
+	Level Level  `inject:"role"`
+	Other string `inject:"other"`
+	B     Base
+	Age   int `inject:"by=B.Age"`
+	Bad   int `inject:"by=B.Missing"`
+}
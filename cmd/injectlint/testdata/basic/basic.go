@@ -0,0 +1,26 @@
+package basic
+
+type Role string
+
+type user struct {
+	Name string
+}
+
+type input struct {
+	ID      int
+	Name    string `inject:"by=ID"`
+	Missing string `inject:"by=Nothing"`
+	Unknown string `inject:"unkown"`
+	Level   int    `inject:"enum=a,b"`
+	Role    Role   `inject:"enum=admin,member"`
+	User    *user  `inject:"by=@named:Name"`
+	Nested  string `inject:"by=User.Age"`
+	Empty   string `inject:"default=a;;enum=a"`
+	Size    bool   `inject:"min=1"`
+}
+
+type optional struct {
+	Email *string `inject:"email"`
+	Age   *int    `inject:"min=18"`
+	Flag  *bool   `inject:"url"`
+}
@@ -0,0 +1,22 @@
+package dive
+
+type item struct {
+	ID   int
+	Name string `inject:"by=ID"`
+}
+
+type input struct {
+	Roles  []string          `inject:"dive;enum=a,b"`
+	Levels []int             `inject:"dive;enum=a,b"`
+	Items  []*item           `inject:"dive"`
+	Tags   map[string]string `inject:"dive;enum=x"`
+	List   Strings           `inject:"dive;email"`
+	Whole  []string          `inject:"enum=a,b"`
+	Name   string            `inject:"dive;enum=a"`
+	Item   *item             `inject:"dive"`
+	Nested [][]string        `inject:"dive;dive;enum=a"`
+	Deep   []string          `inject:"dive;dive"`
+	Any    interface{}       `inject:"dive"`
+}
+
+type Strings []string
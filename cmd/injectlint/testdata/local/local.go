@@ -0,0 +1,25 @@
+package local
+
+func first() {
+	type input struct {
+		ID   int
+		Name string `inject:"by=ID"`
+	}
+	_ = input{}
+}
+
+func second() {
+	type input struct {
+		Code  string
+		Title string `inject:"by=Code"`
+		Bad   string `inject:"by=ID"`
+	}
+	_ = input{}
+	if true {
+		type input struct {
+			Key   string
+			Value string `inject:"by=Key"`
+		}
+		_ = input{}
+	}
+}
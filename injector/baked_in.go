@@ -1,6 +1,7 @@
 package injector
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"reflect"
@@ -17,9 +18,17 @@ const (
 var bakedInAliasInjectors = map[string]string{}
 
 var bakedInInjectorsInit = map[string]TagInitFunc{
-	"enum":    enumTag,
-	"by":      byTag,
-	"default": defaultTag,
+	"enum":     enumTag,
+	"by":       byTag,
+	"default":  defaultTag,
+	"required": requiredTag,
+	"min":      minTag,
+	"max":      maxTag,
+	"len":      lenTag,
+	"regex":    regexTag,
+	"email":    emailTag,
+	"url":      urlTag,
+	"from":     fromTag,
 }
 
 func defaultTag(state *TagFnState) TagFn {
@@ -37,7 +46,10 @@ func defaultTag(state *TagFnState) TagFn {
 				return defaultStr
 			}
 		} else if kind == reflect.Func {
-			fn := d.(func() string)
+			fn, ok := d.(func() string)
+			if !ok {
+				panic(fmt.Sprintf("default func for %s must be func() string, got %T, by %s", state.Field.Kind(), d, state.Param))
+			}
 			getDefault = func() reflect.Value {
 				return reflect.ValueOf(fn())
 			}
@@ -59,7 +71,10 @@ func defaultTag(state *TagFnState) TagFn {
 				return def
 			}
 		} else if kind == reflect.Func {
-			fn := d.(func() int64)
+			fn, ok := d.(func() int64)
+			if !ok {
+				panic(fmt.Sprintf("default func for %s must be func() int64, got %T, by %s", state.Field.Kind(), d, state.Param))
+			}
 			getDefault = func() reflect.Value {
 				return reflect.ValueOf(fn()).Convert(state.Field.Type())
 			}
@@ -80,7 +95,10 @@ func defaultTag(state *TagFnState) TagFn {
 				return def
 			}
 		} else if kind == reflect.Func {
-			fn := d.(func() int64)
+			fn, ok := d.(func() int64)
+			if !ok {
+				panic(fmt.Sprintf("default func for %s must be func() int64, got %T, by %s", state.Field.Kind(), d, state.Param))
+			}
 			getDefault = func() reflect.Value {
 				return reflect.ValueOf(fn()).Convert(state.Field.Type())
 			}
@@ -135,11 +153,13 @@ func enumTag(state *TagFnState) TagFn {
 }
 
 type byResolver struct {
-	matchTagBinding func(useResolver string, byFieldNames []string, by []reflect.Type, to reflect.Type) func(state *TagFnState) (value reflect.Value, err error)
+	matchTagBinding func(param byParam, by []reflect.Type, to reflect.Type) func(state *TagFnState) (value reflect.Value, err error)
 }
 
 var (
 	typTagFnStatePtr = reflect.TypeOf((*TagFnState)(nil))
+	typContext       = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typInterface     = reflect.TypeOf((*interface{})(nil)).Elem()
 )
 
 func (inj *Inject) AddResolver(fn interface{}) (err error) {
@@ -168,19 +188,24 @@ func (inj *Inject) AddResolverWithName(resolverName string, fn interface{}) (err
 		return errors.New("by resolver second out param must be error")
 	}
 	outTyp := tfn.Out(0)
+	info := &resolverInfo{name: resolverName, typ: tfn}
+	inj.addResolverInfo(info)
 	inj.byResolver = append(inj.byResolver, byResolver{
-		matchTagBinding: func(useResolver string, byFieldNames []string, byTypes []reflect.Type, to reflect.Type) func(state *TagFnState) (value reflect.Value, err error) {
-			if useResolver != "" && useResolver != resolverName {
+		matchTagBinding: func(param byParam, byTypes []reflect.Type, to reflect.Type) func(state *TagFnState) (value reflect.Value, err error) {
+			if param.resolver != "" && param.resolver != resolverName {
 				return nil
 			}
+			byFieldNames := param.fields
 			if !outTyp.AssignableTo(to) {
 				return nil
 			}
 
 			resolverInParamsMaker := make([]func(state *TagFnState) (value reflect.Value, err error), len(resolverInParams))
+			// 依赖 TagFnState 的 resolver 结果可能随字段变化, 不缓存
+			memoize := !param.noCache
 			resolverInParamsIdx, byIdx := 0, 0
-			for resolverInParamsIdx < len(resolverInParams) && byIdx < len(byTypes) {
-				if byTypes[byIdx].AssignableTo(resolverInParams[resolverInParamsIdx]) {
+			for resolverInParamsIdx < len(resolverInParams) {
+				if byIdx < len(byTypes) && byTypes[byIdx].AssignableTo(resolverInParams[resolverInParamsIdx]) {
 					thisByIdx := byIdx
 					resolverInParamsMaker[resolverInParamsIdx] = func(state *TagFnState) (value reflect.Value, err error) {
 						v, _, ok := state.Inj.GetStructFieldOK(state.CurrentStruct, byFieldNames[thisByIdx])
@@ -192,15 +217,21 @@ func (inj *Inject) AddResolverWithName(resolverName string, fn interface{}) (err
 					resolverInParamsIdx++
 					byIdx++
 				} else if typTagFnStatePtr.AssignableTo(resolverInParams[resolverInParamsIdx]) {
+					memoize = false
 					resolverInParamsMaker[resolverInParamsIdx] = func(state *TagFnState) (value reflect.Value, err error) {
 						return reflect.ValueOf(state), nil
 					}
 					resolverInParamsIdx++
+				} else if resolverInParams[resolverInParamsIdx] == typContext {
+					resolverInParamsMaker[resolverInParamsIdx] = func(state *TagFnState) (value reflect.Value, err error) {
+						return reflect.ValueOf(state.Context()), nil
+					}
+					resolverInParamsIdx++
 				} else {
 					return nil
 				}
 			}
-			if resolverInParamsIdx < len(resolverInParams) || byIdx < len(byTypes) {
+			if byIdx < len(byTypes) {
 				return nil
 			}
 
@@ -219,7 +250,12 @@ func (inj *Inject) AddResolverWithName(resolverName string, fn interface{}) (err
 					}
 				}()
 
+				if err = state.Context().Err(); err != nil {
+					return value, err
+				}
+
 				in := make([]reflect.Value, len(resolverInParamsMaker))
+				var args []reflect.Value
 				for i, maker := range resolverInParamsMaker {
 					var param reflect.Value
 					param, err = maker(state)
@@ -227,14 +263,28 @@ func (inj *Inject) AddResolverWithName(resolverName string, fn interface{}) (err
 						return value, errors.Wrap(err, fmt.Sprintf("make resolver param %d [%s] error", i, resolverInParams[i].String()))
 					}
 					in[i] = param
+					if resolverInParams[i] != typContext {
+						args = append(args, param)
+					}
 				}
-				out := rfn.Call(in)
-				if len(out) == 2 {
-					if !out[1].IsNil() {
-						return value, out[1].Interface().(error)
+				invoke := func() (reflect.Value, error) {
+					out := rfn.Call(in)
+					if len(out) == 2 {
+						if !out[1].IsNil() {
+							return value, out[1].Interface().(error)
+						}
 					}
+					return out[0], nil
 				}
-				return out[0], nil
+				if memoize {
+					if key, ok := newMemoKey(info, args); ok {
+						invoke = state.Inj.cachedResolve(info, key, invoke)
+						if state.call != nil {
+							return state.call.memo.do(state.Inj, key, invoke)
+						}
+					}
+				}
+				return invoke()
 			}
 		},
 	})
@@ -243,17 +293,37 @@ func (inj *Inject) AddResolverWithName(resolverName string, fn interface{}) (err
 
 var regUseResolver = regexp.MustCompile(`^@(\w+):`)
 
-func byTag(state *TagFnState) TagFn {
-	var in []reflect.Type
-	var useResolver string
-	var parts []string
-	if use := regUseResolver.FindStringSubmatch(state.Param); len(use) == 2 {
-		useResolver = use[1]
-		parts = strings.Split(regUseResolver.ReplaceAllString(state.Param, ""), bySep)
-	} else {
-		parts = strings.Split(state.Param, bySep)
+// by tag 参数, 格式为 [@nocache:][@resolverName:]Field1,Field2
+type byParam struct {
+	resolver string   // 指定使用的 resolver 名称
+	noCache  bool     // 不缓存 resolver 结果, 用于有副作用的 resolver
+	fields   []string // 引用的字段
+}
+
+const byNoCacheFlag = "nocache"
+
+// 解析 by tag 参数
+func parseByParam(param string) (p byParam) {
+	for {
+		use := regUseResolver.FindStringSubmatch(param)
+		if len(use) != 2 {
+			break
+		}
+		if use[1] == byNoCacheFlag {
+			p.noCache = true
+		} else {
+			p.resolver = use[1]
+		}
+		param = param[len(use[0]):]
 	}
+	p.fields = strings.Split(param, bySep)
+	return
+}
 
+func byTag(state *TagFnState) TagFn {
+	var in []reflect.Type
+	param := parseByParam(state.Param)
+	parts := param.fields
 	for _, part := range parts {
 		t := GetFieldTypeByNestedName(state.CurrentStruct.Type(), part)
 		if t == nil || t.Kind() == reflect.Invalid {
@@ -265,11 +335,17 @@ func byTag(state *TagFnState) TagFn {
 	out := state.Field.Type()
 	var exec func(state *TagFnState) (value reflect.Value, err error)
 	for _, r := range state.Inj.byResolver {
-		exec = r.matchTagBinding(useResolver, parts, in, out)
+		exec = r.matchTagBinding(param, in, out)
 		if exec != nil {
 			break
 		}
 	}
+	if b := state.Inj.matchBatchBinding(param.resolver, parts, in, out); b != nil {
+		if state.tag != nil {
+			state.tag.batch = b
+		}
+		exec = b.wrap(exec)
+	}
 	if exec == nil {
 		panic(fmt.Sprintf("by tag init panic: struct: %s, param: %s; out: %s cant find resolver, are you registered?",
 			state.CurrentStruct.Type(), state.Param, out.String()))
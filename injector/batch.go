@@ -0,0 +1,315 @@
+package injector
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+)
+
+// 批量 resolver, 签名为 func([ctx context.Context,] keys []K) (map[K]V | []V[, error])
+// 返回切片时需与 keys 一一对应
+type batchResolver struct {
+	name    string
+	fn      reflect.Value
+	withCtx bool
+	keyTyp  reflect.Type
+	valTyp  reflect.Type
+	byMap   bool
+	withErr bool
+}
+
+// by tag 与批量 resolver 的绑定, 在 byTag 初始化时生成
+type batchBinding struct {
+	resolver *batchResolver
+	field    string // by 引用的字段
+}
+
+type batchResult struct {
+	value reflect.Value
+	err   error
+}
+
+// 单次注入调用内的批量查询结果
+type batchCache struct {
+	mu      sync.Mutex
+	results map[*batchBinding]map[interface{}]batchResult
+}
+
+func (c *batchCache) get(b *batchBinding, key reflect.Value) (batchResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.results[b][key.Interface()]
+	return r, ok
+}
+
+func (c *batchCache) set(b *batchBinding, key reflect.Value, r batchResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil {
+		c.results = map[*batchBinding]map[interface{}]batchResult{}
+	}
+	if c.results[b] == nil {
+		c.results[b] = map[interface{}]batchResult{}
+	}
+	c.results[b][key.Interface()] = r
+}
+
+func (inj *Inject) AddBatchResolver(fn interface{}) (err error) {
+	return inj.AddBatchResolverWithName("", fn)
+}
+
+// 注册批量 resolver, dive 遍历切片或 map 时收集所有元素 by 引用的字段值, 只调用一次批量 resolver
+func (inj *Inject) AddBatchResolverWithName(resolverName string, fn interface{}) (err error) {
+	rfn := reflect.ValueOf(fn)
+	if rfn.Kind() != reflect.Func || rfn.IsNil() {
+		return errors.New("batch resolver must be func")
+	}
+	tfn := rfn.Type()
+
+	r := &batchResolver{name: resolverName, fn: rfn}
+	switch {
+	case tfn.NumIn() == 1:
+	case tfn.NumIn() == 2 && tfn.In(0) == typContext:
+		r.withCtx = true
+	default:
+		return errors.New("batch resolver must have a keys slice in param, optionally preceded by context.Context")
+	}
+	keysTyp := tfn.In(tfn.NumIn() - 1)
+	if keysTyp.Kind() != reflect.Slice {
+		return errors.New("batch resolver keys param must be slice")
+	}
+	r.keyTyp = keysTyp.Elem()
+	if !r.keyTyp.Comparable() {
+		return errors.New("batch resolver key type must be comparable")
+	}
+
+	if tfn.NumOut() > 2 || tfn.NumOut() < 1 {
+		return errors.New("batch resolver must have 1 or 2 out params")
+	}
+	if tfn.NumOut() == 2 {
+		if !tfn.Out(1).Implements(reflect.TypeOf((*error)(nil)).Elem()) {
+			return errors.New("batch resolver second out param must be error")
+		}
+		r.withErr = true
+	}
+	out := tfn.Out(0)
+	switch out.Kind() {
+	case reflect.Map:
+		if out.Key() != r.keyTyp {
+			return errors.New("batch resolver map key type must be the same as keys element type")
+		}
+		r.byMap = true
+	case reflect.Slice:
+	default:
+		return errors.New("batch resolver first out param must be map or slice")
+	}
+	r.valTyp = out.Elem()
+
+	inj.batchResolvers = append(inj.batchResolvers, r)
+	return nil
+}
+
+// 查找可用于 by tag 的批量 resolver, 只支持引用单个字段
+func (inj *Inject) matchBatchBinding(useResolver string, byFieldNames []string, byTypes []reflect.Type, to reflect.Type) *batchBinding {
+	if len(byTypes) != 1 {
+		return nil
+	}
+	for _, r := range inj.batchResolvers {
+		if useResolver != "" && useResolver != r.name {
+			continue
+		}
+		if byTypes[0].AssignableTo(r.keyTyp) && r.valTyp.AssignableTo(to) {
+			return &batchBinding{resolver: r, field: byFieldNames[0]}
+		}
+	}
+	return nil
+}
+
+// 调用批量 resolver, 返回每个 key 的结果, 不在结果中的 key 没有对应项.
+// resolver panic 时转为错误, 错误带有 panic 处的调用栈, 可用 %+v 打印
+func (r *batchResolver) resolve(state *TagFnState, keys []reflect.Value) (results map[interface{}]reflect.Value, err error) {
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+		if pErr, ok := e.(error); ok {
+			err = errors.WithMessage(errors.WithStack(pErr), "batch resolver paniked")
+		} else {
+			err = errors.Errorf("batch resolver paniked: %v", e)
+		}
+	}()
+
+	if err = state.Context().Err(); err != nil {
+		return
+	}
+
+	keySlice := reflect.MakeSlice(reflect.SliceOf(r.keyTyp), len(keys), len(keys))
+	for i, key := range keys {
+		keySlice.Index(i).Set(key)
+	}
+	var in []reflect.Value
+	if r.withCtx {
+		in = append(in, reflect.ValueOf(state.Context()))
+	}
+	in = append(in, keySlice)
+	out := r.fn.Call(in)
+	if r.withErr && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+
+	results = make(map[interface{}]reflect.Value, len(keys))
+	if r.byMap {
+		for i := 0; i < keySlice.Len(); i++ {
+			if v := out[0].MapIndex(keySlice.Index(i)); v.IsValid() {
+				results[keySlice.Index(i).Interface()] = v
+			}
+		}
+		return
+	}
+	if out[0].Len() != len(keys) {
+		return nil, errors.Errorf("batch resolver returned %d values for %d keys", out[0].Len(), len(keys))
+	}
+	for i := 0; i < keySlice.Len(); i++ {
+		results[keySlice.Index(i).Interface()] = out[0].Index(i)
+	}
+	return
+}
+
+// 包装 by tag 的执行函数: 优先使用 dive 预取的结果, 其次单个 resolver, 都没有时以单个 key 调用批量 resolver
+func (b *batchBinding) wrap(single TagFn) TagFn {
+	return func(state *TagFnState) (value reflect.Value, err error) {
+		key, _, ok := state.Inj.GetStructFieldOK(state.CurrentStruct, b.field)
+		if ok && !comparableValue(key) {
+			if single != nil {
+				return single(state)
+			}
+			return value, errors.Errorf("batch resolver key %v is not comparable", key.Interface())
+		}
+		if ok && state.call != nil {
+			if r, found := state.call.batch.get(b, key); found {
+				return r.value, r.err
+			}
+		}
+		if single != nil {
+			return single(state)
+		}
+		if !ok {
+			return value, errors.New(fmt.Sprintf("get filed %s error", b.field))
+		}
+		results, err := b.resolver.resolve(state, []reflect.Value{key})
+		if err != nil {
+			return value, err
+		}
+		v, found := results[key.Interface()]
+		if !found {
+			return value, errors.Errorf("batch resolver returned no value for %v", key.Interface())
+		}
+		return v, nil
+	}
+}
+
+// dive 前预取: 收集所有元素中可批量解析的 by 字段引用值, 每个绑定只调用一次批量 resolver
+func (inj *Inject) prefetchBatch(current reflect.Value, kind reflect.Kind, call *injectCall) {
+	var elems []reflect.Value
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < current.Len(); i++ {
+			elems = append(elems, current.Index(i))
+		}
+	case reflect.Map:
+		iter := current.MapRange()
+		for iter.Next() {
+			elems = append(elems, iter.Value())
+		}
+	default:
+		return
+	}
+
+	// []interface{} 等的元素类型可能不同, 按类型分组分别预取
+	var types []reflect.Type
+	groups := map[reflect.Type][]reflect.Value{}
+	for _, elem := range elems {
+		elem, k, _ := inj.extractTypeInternal(elem, false)
+		if k != reflect.Struct || elem.Type() == timeType {
+			continue
+		}
+		if _, ok := groups[elem.Type()]; !ok {
+			types = append(types, elem.Type())
+		}
+		groups[elem.Type()] = append(groups[elem.Type()], elem)
+	}
+	for _, typ := range types {
+		if structs := groups[typ]; len(structs) > 1 {
+			inj.prefetchStructs(structs, call)
+		}
+	}
+}
+
+// 对同一类型的结构体预取
+func (inj *Inject) prefetchStructs(structs []reflect.Value, call *injectCall) {
+	cs, defErrs := inj.getStructCache(structs[0])
+	if defErrs != nil {
+		// 注入时报告
+		return
+	}
+	for _, idx := range cs.order {
+		f := cs.fields[idx]
+		b := firstBatchBinding(f.cTags)
+		if b == nil {
+			continue
+		}
+		// 引用的字段本身需要注入时, 注入前的值不可靠
+		if dependsOnInjectedField(cs, f) {
+			continue
+		}
+
+		var keys []reflect.Value
+		seen := map[interface{}]bool{}
+		for _, s := range structs {
+			key, _, ok := inj.GetStructFieldOK(s, b.field)
+			// 不可比较的 key 留给注入时处理
+			if !ok || !comparableValue(key) || seen[key.Interface()] {
+				continue
+			}
+			seen[key.Interface()] = true
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		results, err := b.resolver.resolve(&TagFnState{Inj: inj, CtxData: call.ctxData, Ctx: call.ctx, call: call}, keys)
+		for _, key := range keys {
+			if err != nil {
+				call.batch.set(b, key, batchResult{err: err})
+			} else if v, ok := results[key.Interface()]; ok {
+				call.batch.set(b, key, batchResult{value: v})
+			}
+		}
+	}
+}
+
+// 字段第一个执行的 tag 的批量绑定
+func firstBatchBinding(ct *cTag) *batchBinding {
+	for ; ct != nil; ct = ct.next {
+		switch ct.typeof {
+		case typeOmitEmpty, typeExists:
+			continue
+		case typeDefault, typeOr:
+			return ct.batch
+		}
+		return nil
+	}
+	return nil
+}
+
+func dependsOnInjectedField(cs *cStruct, f *cField) bool {
+	for _, dep := range f.deps {
+		if ct := cs.fields[dep].cTags; ct != nil && ct.hasTag {
+			return true
+		}
+	}
+	return false
+}
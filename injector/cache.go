@@ -2,8 +2,9 @@ package injector
 
 import (
 	"fmt"
-	"log"
+	"github.com/pkg/errors"
 	"reflect"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -66,10 +67,13 @@ func (tc *tagCache) Set(key string, value *cTag) {
 }
 
 type cStruct struct {
-	Name   string
-	fields map[int]*cField
-	order  []int
-	fn     StructLevelFunc
+	Name    string
+	defErrs TagDefinitionErrors // tag 定义错误, 不为空时该结构体不能注入
+	fields  map[int]*cField
+	order   []int
+	// 字段间依赖无环, 可以并发注入
+	concurrent bool
+	fn         StructLevelFunc
 }
 
 type cField struct {
@@ -77,6 +81,7 @@ type cField struct {
 	Name    string
 	AltName string
 	cTags   *cTag
+	deps    []int // by, from tag 引用的同级字段
 }
 
 type cTag struct {
@@ -90,6 +95,7 @@ type cTag struct {
 	fn             TagFn
 	next           *cTag
 	Exported       *ExportedCTag
+	batch          *batchBinding // by tag 可用的批量 resolver
 }
 
 type ExportedCTag struct {
@@ -119,6 +125,7 @@ func (inj *Inject) extractStructCache(current reflect.Value, sName string, ctxDa
 	numFields := current.NumField()
 
 	var ctag *cTag
+	var defErrs TagDefinitionErrors
 	var fld reflect.StructField
 	var tag string
 	var customName string
@@ -153,7 +160,7 @@ func (inj *Inject) extractStructCache(current reflect.Value, sName string, ctxDa
 		// and so only struct level caching can be used instead of combined with Field tag caching
 
 		if len(tag) > 0 {
-			ctag, _ = inj.parseFieldTagsRecursive(tag, fld.Name, blank, false, current, current.Field(i), ctxData)
+			ctag, _ = inj.parseFieldTagsRecursive(tag, fld.Name, blank, false, current, current.Field(i), ctxData, &defErrs)
 		} else {
 			// even if field doesn't have injections need cTag for traversing to potential inner/nested
 			// elements of the field.
@@ -164,16 +171,84 @@ func (inj *Inject) extractStructCache(current reflect.Value, sName string, ctxDa
 		cs.order = append(cs.order, i)
 	}
 
+	cs.defErrs = defErrs
+	cs.resolveDeps()
+
 	inj.structCache.Set(typ, cs)
 
 	return cs
 }
 
-func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias string, hasAlias bool, currentStruct reflect.Value, field reflect.Value, ctxData map[string]interface{}) (firstCtag *cTag, current *cTag) {
+// tag 引用的同一结构体中的字段
+func tagFieldRefs(ct *cTag) []string {
+	switch ct.tag {
+	case "by":
+		return parseByParam(ct.param).fields
+	case "from":
+		return strings.SplitN(ct.param, fromSep, 2)[:1]
+	}
+	return nil
+}
+
+// 根据 by, from tag 引用的字段计算依赖, 并检查是否存在循环依赖
+func (cs *cStruct) resolveDeps() {
+	idxByName := make(map[string]int, len(cs.fields))
+	for idx, f := range cs.fields {
+		idxByName[f.Name] = idx
+	}
+
+	inDegree := make(map[int]int, len(cs.fields))
+	dependents := make(map[int][]int, len(cs.fields))
+	for _, idx := range cs.order {
+		f := cs.fields[idx]
+		seen := map[int]bool{}
+		for ct := f.cTags; ct != nil; ct = ct.next {
+			for _, part := range tagFieldRefs(ct) {
+				name := strings.SplitN(part, namespaceSeparator, 2)[0]
+				if i := strings.Index(name, leftBracket); i != -1 {
+					name = name[:i]
+				}
+				dep, ok := idxByName[name]
+				if !ok || seen[dep] {
+					continue
+				}
+				seen[dep] = true
+				f.deps = append(f.deps, dep)
+				dependents[dep] = append(dependents[dep], idx)
+				inDegree[idx]++
+			}
+		}
+	}
+
+	// 拓扑排序, 能排完所有字段说明没有循环依赖
+	var queue []int
+	for _, idx := range cs.order {
+		if inDegree[idx] == 0 {
+			queue = append(queue, idx)
+		}
+	}
+	sorted := 0
+	for len(queue) > 0 {
+		idx := queue[0]
+		queue = queue[1:]
+		sorted++
+		for _, d := range dependents[idx] {
+			inDegree[d]--
+			if inDegree[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	cs.concurrent = sorted == len(cs.order)
+}
+
+func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias string, hasAlias bool, currentStruct reflect.Value, field reflect.Value, ctxData map[string]interface{}, errs *TagDefinitionErrors) (firstCtag *cTag, current *cTag) {
 
 	var t string
 	noAlias := len(alias) == 0
 	tags := strings.Split(tag, tagSeparator)
+	// dive 作用的类型, 每次 dive 后为元素类型; 为 nil 时无法在解析时确定
+	diveType := field.Type()
 
 	for i := 0; i < len(tags); i++ {
 
@@ -188,9 +263,9 @@ func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias s
 			if tagsVal, found := inj.aliasInjectors[t]; found {
 
 				if i == 0 {
-					firstCtag, current = inj.parseFieldTagsRecursive(tagsVal, fieldName, t, true, currentStruct, field, ctxData)
+					firstCtag, current = inj.parseFieldTagsRecursive(tagsVal, fieldName, t, true, currentStruct, field, ctxData, errs)
 				} else {
-					next, curr := inj.parseFieldTagsRecursive(tagsVal, fieldName, t, true, currentStruct, field, ctxData)
+					next, curr := inj.parseFieldTagsRecursive(tagsVal, fieldName, t, true, currentStruct, field, ctxData, errs)
 					current.next, current = next, curr
 
 				}
@@ -211,6 +286,25 @@ func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias s
 
 		case diveTag:
 			current.typeof = typeDive
+			for diveType != nil && diveType.Kind() == reflect.Ptr {
+				diveType = diveType.Elem()
+			}
+			if diveType == nil || diveType.Kind() == reflect.Interface {
+				diveType = nil
+				continue
+			}
+			switch diveType.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				diveType = diveType.Elem()
+			default:
+				*errs = append(*errs, &TagDefinitionError{
+					Struct: currentStruct.Type().Name(),
+					Field:  fieldName,
+					Tag:    diveTag,
+					Err:    errors.Errorf("dive not supported for %s", diveType.Kind()),
+				})
+				diveType = nil
+			}
 			continue
 
 		case omitempty:
@@ -232,14 +326,12 @@ func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias s
 		default:
 
 			// if a pipe character is needed within the param you must use the utf8Pipe representation "0x7C"
-			orVals := strings.Split(t, orSeparator)
+			orItems := splitOrTag(t)
 
-			for j := 0; j < len(orVals); j++ {
-
-				vals := strings.SplitN(orVals[j], tagKeySeparator, 2)
+			for j, item := range orItems {
 
 				if noAlias {
-					alias = vals[0]
+					alias = item.Name
 					current.aliasTag = alias
 				} else {
 					current.actualAliasTag = t
@@ -250,35 +342,36 @@ func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias s
 					current = current.next
 				}
 
-				current.tag = vals[0]
-				if len(current.tag) == 0 {
-					panic(strings.TrimSpace(fmt.Sprintf(invalidInjection, fieldName)))
-				}
+				current.tag = item.Name
 
-				var tagParams = blank
-				if len(vals) > 1 {
-					tagParams = vals[1]
+				defErr := &TagDefinitionError{
+					Struct: currentStruct.Type().Name(),
+					Field:  fieldName,
+					Tag:    current.tag,
+					Param:  item.Param,
 				}
-
-				if initFn, ok := inj.initFuncs[current.tag]; !ok {
-					panic(fmt.Sprintf("tag %s not found for %s.%s", current.tag, currentStruct.Type().Name(), fieldName))
-				} else {
-					current.fn = initFn(&TagFnState{
-						Inj:           inj,
-						CurrentStruct: currentStruct,
-						Field:         field,
-						Param:         tagParams,
-						CtxData:       ctxData,
-					})
+				if len(current.tag) == 0 {
+					defErr.Err = errors.New(strings.TrimSpace(fmt.Sprintf(invalidInjection, fieldName)))
+					*errs = append(*errs, defErr)
+				} else if initFn, ok := inj.initFuncs[current.tag]; !ok {
+					defErr.Err = errors.Errorf("tag %s not found for %s.%s", current.tag, currentStruct.Type().Name(), fieldName)
+					*errs = append(*errs, defErr)
+				} else if current.fn, defErr.Err = callTagInit(initFn, &TagFnState{
+					Inj:           inj,
+					CurrentStruct: currentStruct,
+					Field:         field,
+					Param:         item.Param,
+					CtxData:       ctxData,
+					tag:           current,
+				}); defErr.Err != nil {
+					*errs = append(*errs, defErr)
 				}
 
-				if len(orVals) > 1 {
+				if len(orItems) > 1 {
 					current.typeof = typeOr
 				}
 
-				if len(vals) > 1 {
-					current.param = strings.Replace(strings.Replace(vals[1], utf8HexComma, ",", -1), utf8Pipe, "|", -1)
-				}
+				current.param = strings.Replace(strings.Replace(item.Param, utf8HexComma, ",", -1), utf8Pipe, "|", -1)
 			}
 		}
 	}
@@ -286,24 +379,104 @@ func (inj *Inject) parseFieldTagsRecursive(tag string, fieldName string, alias s
 	return
 }
 
+// tag 初始化函数通过 panic 报告定义错误, 这里转为 error; 运行时错误是初始化函数自身的 bug, 继续 panic
+func callTagInit(initFn TagInitFunc, state *TagFnState) (fn TagFn, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if _, ok := p.(runtime.Error); ok {
+				panic(p)
+			}
+			if e, ok := p.(error); ok {
+				err = e
+			} else {
+				err = errors.New(fmt.Sprint(p))
+			}
+		}
+	}()
+	return initFn(state), nil
+}
+
+// 获取结构体缓存, 不存在时解析; 存在 tag 定义错误时一并返回, 该结构体不能注入
+func (inj *Inject) getStructCache(current reflect.Value) (*cStruct, TagDefinitionErrors) {
+	cs, ok := inj.structCache.Get(current.Type())
+	if !ok {
+		cs = inj.extractStructCache(current, current.Type().Name(), map[string]interface{}{})
+	}
+	if len(cs.defErrs) > 0 {
+		return cs, cs.defErrs
+	}
+	return cs, nil
+}
+
 func (inj *Inject) CacheForStruct(s interface{}) {
 	inj.CacheForStructWithCtxData(s, nil)
 }
 
+// 解析结构体的 tag 并缓存, 存在 tag 定义错误时 panic
 func (inj *Inject) CacheForStructWithCtxData(s interface{}, ctxData map[string]interface{}) {
+	current, err := structValue(s)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	cs := inj.extractStructCache(current, current.Type().Name(), ctxData)
+	if len(cs.defErrs) > 0 {
+		panic(cs.defErrs)
+	}
+}
+
+// 解析结构体及其字段中所有结构体的 tag 并缓存, 返回所有 tag 定义错误
+func (inj *Inject) Prepare(s interface{}) error {
+	return inj.PrepareWithCtxData(s, nil)
+}
+
+func (inj *Inject) PrepareWithCtxData(s interface{}, ctxData map[string]interface{}) error {
+	current, err := structValue(s)
+	if err != nil {
+		return err
+	}
+
+	inj.extractStructCache(current, current.Type().Name(), ctxData)
+	var errs TagDefinitionErrors
+	inj.collectDefinitionErrors(current.Type(), map[reflect.Type]bool{}, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func structValue(s interface{}) (reflect.Value, error) {
 	current := reflect.ValueOf(s)
 	if current.Kind() == reflect.Ptr && !current.IsNil() {
 		current = current.Elem()
 	}
 
 	if current.Kind() != reflect.Struct && current.Kind() != reflect.Interface {
-		log.Println(current.Type(), current.IsNil())
-		panic("value passed for injection is not a struct")
+		return current, errors.New("value passed for injection is not a struct")
 	}
 
 	if !current.CanAddr() {
-		panic("the value passed for injection must be able to be obtained with Addr")
+		return current, errors.New("the value passed for injection must be able to be obtained with Addr")
 	}
+	return current, nil
+}
 
-	inj.extractStructCache(current, current.Type().Name(), ctxData)
+// 递归收集类型中所有结构体的 tag 定义错误, 包括指针, 切片, 数组, map 的元素
+func (inj *Inject) collectDefinitionErrors(typ reflect.Type, visited map[reflect.Type]bool, errs *TagDefinitionErrors) {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType || visited[typ] {
+		return
+	}
+	visited[typ] = true
+
+	cs, ok := inj.structCache.Get(typ)
+	if !ok {
+		cs = inj.extractStructCache(reflect.New(typ).Elem(), typ.Name(), map[string]interface{}{})
+	}
+	*errs = append(*errs, cs.defErrs...)
+	for _, idx := range cs.order {
+		inj.collectDefinitionErrors(typ.Field(cs.fields[idx].Idx).Type, visited, errs)
+	}
 }
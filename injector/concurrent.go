@@ -0,0 +1,163 @@
+package injector
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// 并发注入时 worker 中的 panic, 在调用方 goroutine 中重新 panic, 保留原始值和 worker 的调用栈
+type FieldPanic struct {
+	Field string
+	Value interface{}
+	Stack []byte
+}
+
+func (p *FieldPanic) Error() string {
+	return fmt.Sprintf("inject field %s panic: %v\n%s", p.Field, p.Value, p.Stack)
+}
+
+// 原始值为 error 时可以用 errors.Is / errors.As 判断
+func (p *FieldPanic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+type fieldResult struct {
+	call     *injectCall
+	err      *FieldError
+	panicked *FieldPanic
+	skipped  bool // 非收集模式下依赖的字段失败, 未注入
+}
+
+// 并发遍历结构体字段: 依赖的 by 字段注入完成后才进入就绪队列, 就绪的字段由多个 worker 并行注入.
+// 当前 goroutine 始终作为一个 worker, 额外的 worker 需要从 injectCall.sem 拿到令牌才会启动,
+// 所以嵌套结构体拿不到令牌时退化为串行, 不会互相等待.
+// 错误按字段定义顺序汇总, 保证结果与串行注入一致.
+func (inj *Inject) traverseFieldsConcurrently(topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, partial bool, exclude bool, includeExclude map[string]struct{}, cs *cStruct, call *injectCall) *FieldError {
+	results := make(map[int]*fieldResult, len(cs.order))
+	for _, idx := range cs.order {
+		f := cs.fields[idx]
+		if partial {
+			_, ok := includeExclude[errPrefix+f.Name]
+			if (ok && exclude) || (!ok && !exclude) {
+				continue
+			}
+		}
+		results[idx] = &fieldResult{call: call.fork()}
+	}
+
+	var (
+		mu         sync.Mutex
+		cond       = sync.NewCond(&mu)
+		ready      []int
+		remaining  = len(results)
+		waiting    = make(map[int]int, len(results))
+		dependents = make(map[int][]int, len(results))
+		helpers    sync.WaitGroup
+	)
+	for _, idx := range cs.order {
+		if _, ok := results[idx]; !ok {
+			continue
+		}
+		for _, dep := range cs.fields[idx].deps {
+			if _, ok := results[dep]; ok {
+				waiting[idx]++
+				dependents[dep] = append(dependents[dep], idx)
+			}
+		}
+		if waiting[idx] == 0 {
+			ready = append(ready, idx)
+		}
+	}
+
+	run := func(idx int) {
+		r := results[idx]
+		f := cs.fields[idx]
+		defer func() {
+			if p := recover(); p != nil {
+				r.panicked = &FieldPanic{Field: errPrefix + f.Name, Value: p, Stack: debug.Stack()}
+			}
+		}()
+		if call.ctx.Err() != nil {
+			return
+		}
+		r.err = inj.traverseField(topStruct, currentStruct, current.Field(f.Idx), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, f, f.cTags, r.call)
+	}
+
+	// blocking 为 false 时没有就绪字段就退出
+	var worker func(blocking bool)
+	// 有多余的就绪字段时尝试启动额外的 worker, 需持有 mu
+	spawn := func() {
+		for i := 0; i < len(ready); i++ {
+			select {
+			case call.sem <- struct{}{}:
+				helpers.Add(1)
+				go func() {
+					defer func() {
+						<-call.sem
+						helpers.Done()
+					}()
+					worker(false)
+				}()
+			default:
+				return
+			}
+		}
+	}
+	worker = func(blocking bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		for remaining > 0 {
+			if len(ready) == 0 {
+				if !blocking {
+					return
+				}
+				cond.Wait()
+				continue
+			}
+			idx := ready[0]
+			ready = ready[1:]
+			spawn()
+
+			r := results[idx]
+			if !r.skipped {
+				mu.Unlock()
+				run(idx)
+				mu.Lock()
+			}
+
+			remaining--
+			failed := r.skipped || r.err != nil || r.panicked != nil
+			for _, d := range dependents[idx] {
+				if failed && !call.collectAll {
+					results[d].skipped = true
+				}
+				waiting[d]--
+				if waiting[d] == 0 {
+					ready = append(ready, d)
+				}
+			}
+			cond.Broadcast()
+		}
+	}
+
+	worker(true)
+	helpers.Wait()
+
+	for _, idx := range cs.order {
+		r, ok := results[idx]
+		if !ok {
+			continue
+		}
+		if r.panicked != nil {
+			panic(r.panicked)
+		}
+		call.errs = append(call.errs, r.call.errs...)
+		if r.err != nil && !call.collect(r.err) {
+			return r.err
+		}
+	}
+	return nil
+}
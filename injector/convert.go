@@ -0,0 +1,179 @@
+package injector
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const fromSep = ","
+
+var (
+	typDuration        = reflect.TypeOf(time.Duration(0))
+	typTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// from tag 中可直接使用的时间格式名称
+	timeLayouts = map[string]string{
+		"ANSIC":       time.ANSIC,
+		"UnixDate":    time.UnixDate,
+		"RubyDate":    time.RubyDate,
+		"RFC822":      time.RFC822,
+		"RFC822Z":     time.RFC822Z,
+		"RFC850":      time.RFC850,
+		"RFC1123":     time.RFC1123,
+		"RFC1123Z":    time.RFC1123Z,
+		"RFC3339":     time.RFC3339,
+		"RFC3339Nano": time.RFC3339Nano,
+		"Kitchen":     time.Kitchen,
+		"DateTime":    "2006-01-02 15:04:05",
+		"DateOnly":    "2006-01-02",
+		"TimeOnly":    "15:04:05",
+	}
+)
+
+// from=Field[,layout] 把字符串字段解析为当前字段的类型, 源字段为空时不修改当前字段, 可以与 default 组合.
+// 支持整数, 浮点数, bool, string, time.Duration, time.Time 及实现了 encoding.TextUnmarshaler 的类型, 也可以是它们的指针.
+// time.Time 的 layout 默认为 RFC3339, 可以是 time 包中的格式名称, var@ 变量或格式本身(逗号用 0x2C 表示)
+func fromTag(state *TagFnState) TagFn {
+	if len(state.Param) == 0 {
+		panic("from tag need a param")
+	}
+	params := strings.SplitN(state.Param, fromSep, 2)
+	source := params[0]
+
+	sourceTyp := state.GetFieldType(source)
+	if sourceTyp == nil {
+		panic(fmt.Sprintf("from tag init panic: struct: %s, param: %s, get field %s not ok",
+			state.CurrentStruct.Type(), state.Param, source))
+	}
+	if sourceTyp.Kind() != reflect.String {
+		panic(fmt.Sprintf("from tag source field %s must be string, got %s", source, sourceTyp))
+	}
+
+	typ := state.Field.Type()
+	isPtr := typ.Kind() == reflect.Ptr
+	if isPtr {
+		typ = typ.Elem()
+	}
+
+	var layout string
+	if len(params) > 1 {
+		if typ != timeType {
+			panic(fmt.Sprintf("from tag layout only supported for time.Time, got %s", typ))
+		}
+		layout = parseTimeLayout(state.Inj, params[1])
+	}
+
+	parse := makeParser(typ, layout)
+	return func(state *TagFnState) (value reflect.Value, err error) {
+		raw, _, ok := state.Inj.GetStructFieldOK(state.CurrentStruct, source)
+		if !ok {
+			return state.Field, errors.Errorf("get filed %s error", source)
+		}
+		s := raw.String()
+		if s == "" {
+			return state.Field, nil
+		}
+		v, err := parse(s)
+		if err != nil {
+			return state.Field, err
+		}
+		if isPtr {
+			ptr := reflect.New(typ)
+			ptr.Elem().Set(v)
+			return ptr, nil
+		}
+		return v, nil
+	}
+}
+
+func parseTimeLayout(inj *Inject, param string) string {
+	if layout, ok := timeLayouts[param]; ok {
+		return layout
+	}
+	kind, v := inj.ParseTagValue(param)
+	if kind != reflect.String {
+		panic(fmt.Sprintf("time layout must be string, got %T", v))
+	}
+	if s := v.(string); s != param {
+		return s
+	}
+	return strings.Replace(param, utf8HexComma, ",", -1)
+}
+
+// 生成把字符串解析为 typ 类型的函数
+func makeParser(typ reflect.Type, layout string) func(s string) (reflect.Value, error) {
+	switch {
+	case typ == timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return func(s string) (reflect.Value, error) {
+			t, err := time.Parse(layout, s)
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("[%s] is not a valid time of layout %s", s, layout)
+			}
+			return reflect.ValueOf(t), nil
+		}
+	case typ == typDuration:
+		return func(s string) (reflect.Value, error) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("[%s] is not a valid duration", s)
+			}
+			return reflect.ValueOf(d), nil
+		}
+	case reflect.PtrTo(typ).Implements(typTextUnmarshaler):
+		return func(s string) (reflect.Value, error) {
+			ptr := reflect.New(typ)
+			if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				return reflect.Value{}, err
+			}
+			return ptr.Elem(), nil
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(s string) (reflect.Value, error) {
+			i, err := strconv.ParseInt(s, 10, typ.Bits())
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("[%s] is not a valid %s", s, typ)
+			}
+			return reflect.ValueOf(i).Convert(typ), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(s string) (reflect.Value, error) {
+			i, err := strconv.ParseUint(s, 10, typ.Bits())
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("[%s] is not a valid %s", s, typ)
+			}
+			return reflect.ValueOf(i).Convert(typ), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(s string) (reflect.Value, error) {
+			f, err := strconv.ParseFloat(s, typ.Bits())
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("[%s] is not a valid %s", s, typ)
+			}
+			return reflect.ValueOf(f).Convert(typ), nil
+		}
+	case reflect.Bool:
+		return func(s string) (reflect.Value, error) {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("[%s] is not a valid bool", s)
+			}
+			return reflect.ValueOf(b).Convert(typ), nil
+		}
+	case reflect.String:
+		return func(s string) (reflect.Value, error) {
+			return reflect.ValueOf(s).Convert(typ), nil
+		}
+	}
+	panic(fmt.Sprintf("from tag not supported for %s", typ))
+}
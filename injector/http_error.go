@@ -0,0 +1,92 @@
+package injector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// resolver 找不到数据时返回(或包装)该错误, 注入错误以 404 响应
+var ErrNotFound = errors.New("not found")
+
+const problemContentType = "application/problem+json"
+
+// RFC 7807 问题详情
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Errors   []ProblemField `json:"errors,omitempty"`
+}
+
+type ProblemField struct {
+	Field   string `json:"field"`
+	Name    string `json:"name,omitempty"`
+	Tag     string `json:"tag"`
+	Message string `json:"message"`
+}
+
+// resolver 返回 ErrNotFound 时为 404, 其余为 400
+func (err FieldError) HttpStatusCode() int {
+	if errors.Is(err.InjectError, ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func (err FieldError) problemField() ProblemField {
+	f := ProblemField{
+		Field: err.FieldNamespace,
+		Name:  err.NameNamespace,
+		Tag:   err.Tag,
+	}
+	if err.InjectError != nil {
+		f.Message = err.InjectError.Error()
+	}
+	return f
+}
+
+func (err FieldError) WriteHttpResponse(writer http.ResponseWriter, request *http.Request) {
+	writeProblem(writer, request, err.HttpStatusCode(), []ProblemField{err.problemField()})
+}
+
+// 所有字段都是 ErrNotFound 时为 404, 否则为 400
+func (errs FieldErrors) HttpStatusCode() int {
+	for _, err := range errs {
+		if err.HttpStatusCode() != http.StatusNotFound {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusNotFound
+}
+
+func (errs FieldErrors) WriteHttpResponse(writer http.ResponseWriter, request *http.Request) {
+	fields := make([]ProblemField, len(errs))
+	for i, err := range errs {
+		fields[i] = err.problemField()
+	}
+	writeProblem(writer, request, errs.HttpStatusCode(), fields)
+}
+
+// tag 定义错误是服务端的问题, 以 500 响应
+func (errs TagDefinitionErrors) HttpStatusCode() int {
+	return http.StatusInternalServerError
+}
+
+func writeProblem(writer http.ResponseWriter, request *http.Request, status int, fields []ProblemField) {
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: "field injection failed",
+		Errors: fields,
+	}
+	if request != nil && request.URL != nil {
+		problem.Instance = request.URL.Path
+	}
+	writer.Header().Set("Content-Type", problemContentType)
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(problem)
+}
@@ -1,10 +1,19 @@
 package injector
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type userInput struct {
@@ -184,3 +193,876 @@ func TestInjectByNestedField(t *testing.T) {
 		return
 	}
 }
+
+func TestStructCollectAllErrors(t *testing.T) {
+	inject := New(&Config{
+		TagName:          "inject",
+		FieldNameTag:     "",
+		CollectAllErrors: true,
+	})
+	err := inject.AddResolver(userByUsername)
+	if err != nil {
+		panic(err)
+	}
+	err = inject.AddResolver(userByUsernameAndRole)
+	if err != nil {
+		panic(err)
+	}
+	type temp struct {
+		Role string       `inject:"enum=agent,miner"`
+		List []*userInput `inject:"dive"`
+	}
+	inject.CacheForStruct(&temp{})
+	param := &temp{
+		Role: "boss",
+		List: []*userInput{
+			{Username1: "peter", Role: "miner"},
+			{Username1: "fuck", Username2: "fuck", Role: "boss"},
+		},
+	}
+	err = inject.Struct(param)
+	if !assert.Error(t, err) {
+		return
+	}
+	errs, ok := err.(FieldErrors)
+	if !assert.True(t, ok) {
+		return
+	}
+	var namespaces []string
+	for _, e := range errs {
+		namespaces = append(namespaces, e.FieldNamespace)
+	}
+	assert.Equal(t, []string{"temp.Role", "temp.List[1].Role", "temp.List[1].User", "temp.List[1].User2"}, namespaces)
+	assert.NotNil(t, param.List[0].User)
+}
+
+func TestStructStopAtFirstError(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	type temp struct {
+		A string `inject:"enum=a,b"`
+		B string `inject:"enum=a,b"`
+	}
+	inject.CacheForStruct(&temp{})
+	err := inject.Struct(&temp{A: "c", B: "c"})
+	fieldErr, ok := err.(*FieldError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "temp.A", fieldErr.FieldNamespace)
+}
+
+func TestStructCtx(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	type ctxKey struct{}
+	type input struct {
+		A int
+		B int `inject:"by=A"`
+	}
+	err := inject.AddResolver(func(a int, ctx context.Context, state *TagFnState) (int, error) {
+		if ctx != state.Context() {
+			return 0, errors.New("ctx not match")
+		}
+		base, _ := ctx.Value(ctxKey{}).(int)
+		return base + a, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	inject.CacheForStruct(&input{})
+
+	param := &input{A: 1}
+	err = inject.StructCtx(context.WithValue(context.Background(), ctxKey{}, 10), param)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 11, param.B)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	param = &input{A: 1}
+	err = inject.StructCtx(ctx, param)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, param.B)
+}
+
+func TestStructCtxCancelDuringTraversal(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	type input struct {
+		A int
+		B int `inject:"by=A"`
+		C int `inject:"by=A"`
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var called int
+	err := inject.AddResolver(func(ctx context.Context, a int) int {
+		called++
+		cancel()
+		return a
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = inject.StructPartialCtx(ctx, &input{A: 1}, "B", "C")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, called)
+}
+
+func TestStructCtxResolverError(t *testing.T) {
+	type input struct {
+		A int
+		B int `inject:"by=A"`
+		C int `inject:"by=A"`
+	}
+	for _, collect := range []bool{false, true} {
+		inject := New(&Config{
+			TagName:          "inject",
+			FieldNameTag:     "",
+			CollectAllErrors: collect,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		// resolver 看到 ctx 结束后返回 ctx.Err()
+		err := inject.AddResolver(func(ctx context.Context, a int) (int, error) {
+			cancel()
+			return 0, ctx.Err()
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = inject.StructCtx(ctx, &input{A: 1})
+		assert.True(t, errors.Is(err, context.Canceled), "collect %v: %v", collect, err)
+	}
+
+	// 字段错误可以解包出 resolver 返回的错误
+	fieldErr := &FieldError{InjectError: ErrNotFound}
+	assert.True(t, errors.Is(fieldErr, ErrNotFound))
+}
+
+func TestStructConcurrent(t *testing.T) {
+	inject := New(&Config{
+		TagName:        "inject",
+		FieldNameTag:   "",
+		MaxConcurrency: 3,
+	})
+	type input struct {
+		ID      int
+		Name    string `inject:"by=ID"`
+		Greet   string `inject:"by=Name"`
+		Double  int    `inject:"by=ID"`
+		Invalid int    `inject:"by=Double"`
+	}
+	var running, maxRunning int32
+	var mu sync.Mutex
+	track := func() func() {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		return func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}
+	}
+	err := inject.AddResolver(func(id int) string {
+		defer track()()
+		return fmt.Sprintf("user%d", id)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = inject.AddResolver(func(name string) (string, error) {
+		defer track()()
+		if name == "" {
+			return "", errors.New("name not injected")
+		}
+		return "hello " + name, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var doubleCalls int32
+	err = inject.AddResolver(func(id int) (int, error) {
+		defer track()()
+		atomic.AddInt32(&doubleCalls, 1)
+		if id < 0 {
+			return 0, errors.New("negative id")
+		}
+		return id * 2, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	param := &input{ID: 2}
+	err = inject.Struct(param)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "user2", param.Name)
+	assert.Equal(t, "hello user2", param.Greet)
+	assert.Equal(t, 4, param.Double)
+	assert.Equal(t, 8, param.Invalid)
+	assert.LessOrEqual(t, maxRunning, int32(3))
+
+	// Double 失败后依赖它的 Invalid 不再注入
+	atomic.StoreInt32(&doubleCalls, 0)
+	err = inject.Struct(&input{ID: -1})
+	fieldErr, ok := err.(*FieldError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "input.Double", fieldErr.FieldNamespace)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&doubleCalls))
+}
+
+func TestStructConcurrentPanic(t *testing.T) {
+	inject := New(&Config{
+		TagName:        "inject",
+		FieldNameTag:   "",
+		MaxConcurrency: 2,
+	})
+	errBroken := errors.New("broken")
+	inject.RegisterInjection("broken", func(state *TagFnState) TagFn {
+		return func(state *TagFnState) (reflect.Value, error) {
+			panic(errBroken)
+		}
+	})
+	type input struct {
+		A string `inject:"broken"`
+		B string
+	}
+	defer func() {
+		p, ok := recover().(*FieldPanic)
+		if !assert.True(t, ok) {
+			return
+		}
+		assert.Equal(t, "input.A", p.Field)
+		assert.True(t, errors.Is(p, errBroken))
+		assert.NotEmpty(t, p.Stack)
+	}()
+	_ = inject.Struct(&input{})
+}
+
+func TestBatchResolver(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	var singleCalls, batchCalls int
+	err := inject.AddResolver(func(username string) (*user, error) {
+		singleCalls++
+		return userByUsername(username)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = inject.AddBatchResolver(func(ctx context.Context, usernames []string) (map[string]*user, error) {
+		batchCalls++
+		m := map[string]*user{}
+		for _, username := range usernames {
+			if username != "nobody" {
+				m[username] = &user{Username: username}
+			}
+		}
+		return m, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type item struct {
+		Username string
+		User     *user `inject:"by=Username"`
+	}
+	type temp struct {
+		List []*item `inject:"dive"`
+	}
+	param := &temp{
+		List: []*item{{Username: "peter"}, {Username: "tom"}, {Username: "peter"}, {Username: "nobody"}},
+	}
+	err = inject.Struct(param)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, batchCalls)
+	// nobody 不在批量结果中, 回退到单个 resolver
+	assert.Equal(t, 1, singleCalls)
+	for _, it := range param.List {
+		if assert.NotNil(t, it.User) {
+			assert.Equal(t, it.Username, it.User.Username)
+		}
+	}
+
+	// 不在 dive 中时使用单个 resolver
+	single := &item{Username: "jerry"}
+	err = inject.Struct(single)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, batchCalls)
+	assert.Equal(t, 2, singleCalls)
+}
+
+func TestBatchResolverMixedTypes(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	var idCalls, codeCalls int
+	err := inject.AddBatchResolver(func(ids []int) map[int]string {
+		idCalls++
+		m := map[int]string{}
+		for _, id := range ids {
+			m[id] = fmt.Sprintf("user%d", id)
+		}
+		return m
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = inject.AddBatchResolver(func(codes []string) []string {
+		codeCalls++
+		if len(codes) > 1 {
+			panic("too many codes")
+		}
+		return codes
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type byID struct {
+		ID   int
+		Name string `inject:"by=ID"`
+	}
+	type byCode struct {
+		Code  string
+		Title string `inject:"by=Code"`
+	}
+	type temp struct {
+		List []interface{} `inject:"dive"`
+	}
+	param := &temp{List: []interface{}{&byCode{Code: "a"}, &byID{ID: 1}, &byID{ID: 2}}}
+	err = inject.Struct(param)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, idCalls)
+	assert.Equal(t, "a", param.List[0].(*byCode).Title)
+	assert.Equal(t, "user1", param.List[1].(*byID).Name)
+	assert.Equal(t, "user2", param.List[2].(*byID).Name)
+
+	// 批量 resolver panic 时转为字段错误
+	err = inject.Struct(&temp{List: []interface{}{&byCode{Code: "a"}, &byCode{Code: "b"}}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "too many codes")
+	}
+}
+
+func TestBatchResolverSliceResult(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	var batchCalls int
+	err := inject.AddBatchResolver(func(ids []int) ([]string, error) {
+		batchCalls++
+		names := make([]string, len(ids))
+		for i, id := range ids {
+			names[i] = fmt.Sprintf("user%d", id)
+		}
+		return names, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type item struct {
+		ID   int
+		Name string `inject:"by=ID"`
+	}
+	type temp struct {
+		List []*item `inject:"dive"`
+	}
+	param := &temp{List: []*item{{ID: 1}, {ID: 2}, {ID: 3}}}
+	err = inject.Struct(param)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, batchCalls)
+	assert.Equal(t, "user3", param.List[2].Name)
+
+	// 没有单个 resolver 时以单个 key 调用批量 resolver
+	it := &item{ID: 4}
+	err = inject.Struct(it)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "user4", it.Name)
+}
+
+func TestResolverMemo(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	var calls int
+	err := inject.AddResolver(func(username string) (*user, error) {
+		calls++
+		return userByUsername(username)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type temp struct {
+		Username string
+		User     *user `inject:"by=Username"`
+		Owner    *user `inject:"by=Username"`
+		Fresh    *user `inject:"by=@nocache:Username"`
+	}
+	param := &temp{Username: "peter"}
+	err = inject.Struct(param)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, calls)
+	assert.True(t, param.User == param.Owner)
+	assert.False(t, param.User == param.Fresh)
+	assert.Equal(t, MemoStats{Hits: 1, Misses: 1}, inject.MemoStats())
+
+	// 缓存只在单次注入内有效
+	err = inject.Struct(&temp{Username: "peter"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, MemoStats{Hits: 2, Misses: 2}, inject.MemoStats())
+}
+
+func TestResolverMemoPanic(t *testing.T) {
+	for _, maxConcurrency := range []int{0, 4} {
+		inject := New(&Config{
+			TagName:          "inject",
+			CollectAllErrors: true,
+			MaxConcurrency:   maxConcurrency,
+		})
+		err := inject.AddResolver(func(username string) (*user, error) {
+			panic("resolver broken")
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		type temp struct {
+			Username string
+			User     *user `inject:"by=Username"`
+			Owner    *user `inject:"by=Username"`
+		}
+		err = inject.Struct(&temp{Username: "peter"})
+		var errs FieldErrors
+		if !assert.True(t, errors.As(err, &errs), "max concurrency %d", maxConcurrency) {
+			continue
+		}
+		assert.Len(t, errs, 2)
+		for _, fe := range errs {
+			assert.Contains(t, fe.Error(), "resolver broken")
+		}
+	}
+
+	// panic 的错误被缓存后仍可以用 errors.Is 判断
+	inject := New(&Config{
+		TagName:          "inject",
+		CollectAllErrors: true,
+	})
+	err := inject.AddResolver(func(username string) (*user, error) {
+		panic(ErrNotFound)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type temp struct {
+		Username string
+		User     *user `inject:"by=Username"`
+		Owner    *user `inject:"by=Username"`
+	}
+	err = inject.Struct(&temp{Username: "peter"})
+	var errs FieldErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 2) {
+		for _, fe := range errs {
+			assert.True(t, errors.Is(fe, ErrNotFound))
+		}
+		assert.Equal(t, http.StatusNotFound, errs.HttpStatusCode())
+	}
+}
+
+func TestResolverCache(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	var calls int
+	err := inject.AddResolverWithName("user", func(username string) (*user, error) {
+		calls++
+		return userByUsername(username)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	inject.SetResolverCache("user", NewLRUResolverCache(10), time.Minute)
+	type temp struct {
+		Username string
+		User     *user `inject:"by=@user:Username"`
+	}
+
+	first := &temp{Username: "peter"}
+	if !assert.NoError(t, inject.Struct(first)) {
+		return
+	}
+	second := &temp{Username: "peter"}
+	if !assert.NoError(t, inject.Struct(second)) {
+		return
+	}
+	assert.Equal(t, 1, calls)
+	assert.True(t, first.User == second.User)
+
+	// 错误不缓存
+	assert.Error(t, inject.Struct(&temp{Username: "fuck"}))
+	assert.Error(t, inject.Struct(&temp{Username: "fuck"}))
+	assert.Equal(t, 3, calls)
+
+	inject.InvalidateResolver("user", "peter")
+	third := &temp{Username: "peter"}
+	if !assert.NoError(t, inject.Struct(third)) {
+		return
+	}
+	assert.Equal(t, 4, calls)
+	assert.False(t, first.User == third.User)
+}
+
+func TestResolverCacheShared(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	err := inject.AddResolverWithName("admin", func(username string) (*user, error) {
+		return &user{RoleType: 1, Username: username}, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = inject.AddResolverWithName("member", func(username string) (*user, error) {
+		return &user{RoleType: 2, Username: username}, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	cache := NewLRUResolverCache(10)
+	inject.SetResolverCache("admin", cache, time.Minute)
+	inject.SetResolverCache("member", cache, time.Minute)
+	type temp struct {
+		Username string
+		Admin    *user `inject:"by=@admin:Username"`
+		Member   *user `inject:"by=@member:Username"`
+	}
+
+	for i := 0; i < 2; i++ {
+		param := &temp{Username: "peter"}
+		if !assert.NoError(t, inject.Struct(param)) {
+			return
+		}
+		assert.Equal(t, int64(1), param.Admin.RoleType)
+		assert.Equal(t, int64(2), param.Member.RoleType)
+	}
+}
+
+func TestLRUResolverCache(t *testing.T) {
+	cache := NewLRUResolverCache(2)
+	cache.Set("a", 1, 0)
+	cache.Set("b", 2, 0)
+	_, _ = cache.Get("a")
+	cache.Set("c", 3, 0)
+	_, ok := cache.Get("b")
+	assert.False(t, ok)
+	v, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	cache.Set("d", 4, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok = cache.Get("d")
+	assert.False(t, ok)
+}
+
+func TestPrepare(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	type nested struct {
+		Count int `inject:"enum=a,b"`
+	}
+	inject.AddFunc("str", func() string { return "" })
+	type input struct {
+		Name   string `inject:"unknown"`
+		Age    int    `inject:"default=fn@missing"`
+		Level  int    `inject:"default=fn@str"`
+		Tag    string `inject:"dive;enum=a"`
+		User   *user  `inject:"by=Name"`
+		Nested []nested
+	}
+	err := inject.Prepare(&input{})
+	defErrs, ok := err.(TagDefinitionErrors)
+	if !assert.True(t, ok) {
+		return
+	}
+	var got []string
+	for _, e := range defErrs {
+		got = append(got, e.Struct+"."+e.Field+":"+e.Tag)
+	}
+	assert.Equal(t, []string{"input.Name:unknown", "input.Age:default", "input.Level:default", "input.Tag:dive", "input.User:by", "user.RoleType:by", "nested.Count:enum"}, got)
+
+	assert.Equal(t, err, Verify(inject, input{}))
+
+	// 注入时返回错误而不是 panic
+	err = inject.Struct(&input{})
+	_, ok = err.(TagDefinitionErrors)
+	assert.True(t, ok)
+
+	assert.Panics(t, func() {
+		inject.CacheForStruct(&input{})
+	})
+
+	// 并发注入时嵌套结构体的 tag 定义错误同样作为返回值
+	concurrent := New(&Config{
+		TagName:        "inject",
+		FieldNameTag:   "",
+		MaxConcurrency: 4,
+	})
+	type outer struct {
+		A      string
+		B      string
+		Nested nested
+	}
+	err = concurrent.Struct(&outer{})
+	_, ok = err.(TagDefinitionErrors)
+	assert.True(t, ok)
+
+	// tag 初始化函数自身的运行时错误不会被当作定义错误
+	inject.RegisterInjection("buggy", func(state *TagFnState) TagFn {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	})
+	type buggy struct {
+		Name string `inject:"buggy"`
+	}
+	assert.Panics(t, func() {
+		_ = inject.Prepare(&buggy{})
+	})
+}
+
+func TestVerify(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	err := inject.AddResolver(userByUsername)
+	if err != nil {
+		panic(err)
+	}
+	type good struct {
+		Username string
+		User     *user `inject:"by=Username"`
+	}
+	type bad struct {
+		Username string
+		Count    int `inject:"by=Username"`
+	}
+	err = Verify(inject, (*good)(nil), bad{})
+	defErrs, ok := err.(TagDefinitionErrors)
+	if !assert.True(t, ok) {
+		return
+	}
+	var got []string
+	for _, e := range defErrs {
+		got = append(got, e.Struct+"."+e.Field)
+	}
+	// user.RoleType 的 by=hah 引用了不存在的字段
+	assert.Equal(t, []string{"user.RoleType", "bad.Count"}, got)
+
+	assert.Error(t, Verify(inject, 1))
+}
+
+func TestValidationTags(t *testing.T) {
+	inject := New(&Config{
+		TagName:          "inject",
+		FieldNameTag:     "",
+		CollectAllErrors: true,
+	})
+	inject.RegisterAliasInjection("contact", "email|url")
+	type input struct {
+		Name    string      `inject:"required;min=2;max=5"`
+		Age     *int        `inject:"min=18"`
+		Tags    []string    `inject:"len=2"`
+		Code    string      `inject:"regex=^[a-z]{3}$"`
+		Contact string      `inject:"contact"`
+		Score   float64     `inject:"omitempty;max=1.5"`
+		Email   *string     `inject:"email"`
+		Extra   interface{} `inject:"required"`
+	}
+	// 非 nil 的指针和接口字段, 校验后回写原始字段的值
+	age := 20
+	email := "peter@example.com"
+	param := &input{Name: "peter", Age: &age, Tags: []string{"a", "b"}, Code: "abc", Contact: "https://example.com", Email: &email, Extra: "x"}
+	if !assert.NoError(t, inject.Struct(param)) {
+		return
+	}
+	assert.Equal(t, &age, param.Age)
+	assert.Equal(t, "x", param.Extra)
+
+	// 可选的指针字段为 nil 时不校验
+	param.Age, param.Email = nil, nil
+	if !assert.NoError(t, inject.Struct(param)) {
+		return
+	}
+
+	age = 10
+	email = "peter"
+	err := inject.Struct(&input{Name: "p", Age: &age, Tags: []string{"a"}, Code: "abcd", Contact: "peter", Score: 2, Email: &email, Extra: "x"})
+	errs, ok := err.(FieldErrors)
+	if !assert.True(t, ok) {
+		return
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Field+":"+e.Tag)
+	}
+	assert.Equal(t, []string{"Name:min", "Age:min", "Tags:len", "Code:regex", "Contact:contact", "Score:max", "Email:email"}, got)
+
+	err = inject.Struct(&input{})
+	errs, ok = err.(FieldErrors)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "required", errs[0].Tag)
+
+	type bad struct {
+		Count int `inject:"email"`
+	}
+	assert.Error(t, inject.Prepare(&bad{}))
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level " + string(text))
+	}
+	return nil
+}
+
+func TestFromTag(t *testing.T) {
+	inject := New(&Config{
+		TagName:      "inject",
+		FieldNameTag: "",
+	})
+	inject.AddVar("dayLayout", "2006/01/02")
+	type input struct {
+		RawLimit   string
+		RawRatio   string
+		RawOn      string
+		RawAt      string
+		RawDay     string
+		RawTimeout string
+		RawLevel   string
+
+		Limit   int           `inject:"from=RawLimit;default=20"`
+		Ratio   *float64      `inject:"from=RawRatio"`
+		On      bool          `inject:"from=RawOn"`
+		At      time.Time     `inject:"from=RawAt,DateOnly"`
+		Day     time.Time     `inject:"from=RawDay,var@dayLayout"`
+		Timeout time.Duration `inject:"from=RawTimeout"`
+		Level   level         `inject:"from=RawLevel"`
+	}
+	param := &input{RawRatio: "0.5", RawOn: "true", RawAt: "2024-01-02", RawDay: "2024/03/04", RawTimeout: "1m30s", RawLevel: "high"}
+	if !assert.NoError(t, inject.Struct(param)) {
+		return
+	}
+	assert.Equal(t, 20, param.Limit)
+	if assert.NotNil(t, param.Ratio) {
+		assert.Equal(t, 0.5, *param.Ratio)
+	}
+	assert.True(t, param.On)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), param.At)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), param.Day)
+	assert.Equal(t, 90*time.Second, param.Timeout)
+	assert.Equal(t, level(2), param.Level)
+
+	err := inject.Struct(&input{RawLimit: "ten"})
+	fieldErr, ok := err.(*FieldError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "from", fieldErr.Tag)
+	assert.Equal(t, "input.Limit", fieldErr.FieldNamespace)
+
+	type bad struct {
+		Raw   int
+		Limit int `inject:"from=Raw"`
+	}
+	assert.Error(t, inject.Prepare(&bad{}))
+}
+
+func TestFieldErrorHttpResponse(t *testing.T) {
+	inject := New(&Config{
+		TagName:          "inject",
+		FieldNameTag:     "json",
+		CollectAllErrors: true,
+	})
+	err := inject.AddResolver(func(username string) (*user, error) {
+		return nil, errors.Wrap(ErrNotFound, "user "+username)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type input struct {
+		Username string `json:"username"`
+		Role     string `inject:"enum=agent,miner" json:"role"`
+		User     *user  `inject:"by=Username" json:"user"`
+	}
+
+	err = inject.Struct(&input{Username: "peter"})
+	recorder := httptest.NewRecorder()
+	err.(FieldErrors)[0].WriteHttpResponse(recorder, httptest.NewRequest("GET", "/users", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+	var problem Problem
+	if !assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem)) {
+		return
+	}
+	assert.Equal(t, "/users", problem.Instance)
+	assert.Equal(t, []ProblemField{{Field: "input.User", Name: "input.user", Tag: "by", Message: "user peter: not found"}}, problem.Errors)
+
+	err = inject.Struct(&input{Username: "peter", Role: "boss"})
+	recorder = httptest.NewRecorder()
+	err.(FieldErrors).WriteHttpResponse(recorder, httptest.NewRequest("GET", "/users", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	if !assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem)) {
+		return
+	}
+	assert.Len(t, problem.Errors, 2)
+	assert.Equal(t, "input.role", problem.Errors[0].Name)
+}
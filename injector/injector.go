@@ -1,10 +1,12 @@
 package injector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,6 +23,7 @@ const (
 	diveTag                = "dive"
 	existsTag              = "exists"
 	fieldErrMsg            = "Key: '%s' Error:Field injection for '%s' failed on the '%s' tag: %s"
+	tagDefinitionErrMsg    = "Struct: '%s' Field: '%s' Error:Tag '%s' with param '%s' is invalid: %s"
 	arrayIndexFieldName    = "%s" + leftBracket + "%d" + rightBracket
 	mapIndexFieldName      = "%s" + leftBracket + "%v" + rightBracket
 	invalidInjection       = "Invalid injection tag on field %s"
@@ -54,6 +57,18 @@ type TagFnState struct {
 	Field         reflect.Value
 	Param         string
 	CtxData       map[string]interface{}
+	Ctx           context.Context
+
+	call *injectCall // 注入时的调用状态
+	tag  *cTag       // 初始化时正在解析的 tag
+}
+
+// 本次注入的 context, 未指定时为 context.Background()
+func (s *TagFnState) Context() context.Context {
+	if s.Ctx != nil {
+		return s.Ctx
+	}
+	return context.Background()
 }
 
 func (s *TagFnState) Get(key string) interface{} {
@@ -74,6 +89,10 @@ func (s *TagFnState) GetFieldValue(namespace string) reflect.Value {
 
 // 注入器结构体
 type Inject struct {
+	// 原子操作的 int64 放在开头保证 32 位平台对齐
+	memoHits   int64
+	memoMisses int64
+
 	tagName             string
 	fieldNameTag        string
 	initFuncs           map[string]TagInitFunc
@@ -85,8 +104,15 @@ type Inject struct {
 	structCache         *structCache
 	funcs               map[string]interface{}
 	variables           map[string]interface{}
+	collectAllErrors    bool
+	maxConcurrency      int
+
+	byResolver     []byResolver
+	batchResolvers []*batchResolver
 
-	byResolver []byResolver
+	resolverCacheMu sync.RWMutex
+	resolverCaches  map[string]*resolverCacheConfig
+	resolverInfos   map[string][]*resolverInfo
 }
 
 func (inj *Inject) initCheck() {
@@ -99,6 +125,10 @@ func (inj *Inject) initCheck() {
 type Config struct {
 	TagName      string
 	FieldNameTag string
+	// 遇到字段注入错误时继续遍历, 最终以 FieldErrors 返回所有失败的字段
+	CollectAllErrors bool
+	// 同时注入的最大字段数, 大于 1 时互不依赖的 by 字段并行解析
+	MaxConcurrency int
 }
 
 // tag 初始化函数
@@ -126,6 +156,98 @@ func (err FieldError) Error() string {
 	return fmt.Sprintf(fieldErrMsg, err.FieldNamespace, err.Field, err.Tag, err.InjectError)
 }
 
+func (err FieldError) Unwrap() error {
+	return err.InjectError
+}
+
+// tag 定义错误, 如 tag 不存在, 参数错误, 找不到 resolver, 字段类型不支持等
+type TagDefinitionError struct {
+	Struct string
+	Field  string
+	Tag    string
+	Param  string
+	Err    error
+}
+
+func (err *TagDefinitionError) Error() string {
+	return fmt.Sprintf(tagDefinitionErrMsg, err.Struct, err.Field, err.Tag, err.Param, err.Err)
+}
+
+func (err *TagDefinitionError) Unwrap() error {
+	return err.Err
+}
+
+// 结构体中所有的 tag 定义错误
+type TagDefinitionErrors []*TagDefinitionError
+
+func (errs TagDefinitionErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// 多个字段注入错误, 开启 Config.CollectAllErrors 时返回
+type FieldErrors []*FieldError
+
+func (errs FieldErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// 单次注入调用的状态
+type injectCall struct {
+	ctx        context.Context
+	ctxData    map[string]interface{}
+	collectAll bool
+	errs       FieldErrors
+	sem        chan struct{} // 并发令牌, nil 表示串行注入
+	batch      *batchCache
+	memo       *memoCache
+	abort      *callAbort
+}
+
+// 遍历中遇到 tag 定义错误时记录并取消 ctx, 所有 fork 共享
+type callAbort struct {
+	once    sync.Once
+	defErrs TagDefinitionErrors
+	cancel  context.CancelFunc
+}
+
+// 记录第一次遇到的 tag 定义错误, 通过取消 ctx 让其他字段停止遍历
+func (a *callAbort) fail(defErrs TagDefinitionErrors) {
+	a.once.Do(func() {
+		a.defErrs = defErrs
+		a.cancel()
+	})
+}
+
+// 并发注入时每个字段单独收集错误, 最后按字段顺序合并
+func (call *injectCall) fork() *injectCall {
+	return &injectCall{
+		ctx:        call.ctx,
+		ctxData:    call.ctxData,
+		collectAll: call.collectAll,
+		sem:        call.sem,
+		batch:      call.batch,
+		memo:       call.memo,
+		abort:      call.abort,
+	}
+}
+
+// 收集模式下记录错误并返回 true, 调用方应继续遍历
+func (call *injectCall) collect(err *FieldError) bool {
+	if !call.collectAll {
+		return false
+	}
+	call.errs = append(call.errs, err)
+	return true
+}
+
 // 创建注入器实例
 func New(config *Config) *Inject {
 
@@ -136,9 +258,11 @@ func New(config *Config) *Inject {
 	sc.m.Store(make(map[reflect.Type]*cStruct))
 
 	inj := &Inject{
-		tagName:      config.TagName,
-		fieldNameTag: config.FieldNameTag,
-		structCache:  sc}
+		tagName:          config.TagName,
+		fieldNameTag:     config.FieldNameTag,
+		collectAllErrors: config.CollectAllErrors,
+		maxConcurrency:   config.MaxConcurrency,
+		structCache:      sc}
 
 	inj.funcs = map[string]interface{}{}
 	inj.variables = map[string]interface{}{}
@@ -216,7 +340,16 @@ func (inj *Inject) RegisterAliasInjection(alias, tags string) {
 func (inj *Inject) StructPartial(current interface{}, fields ...string) error {
 	return inj.StructPartialWithCtxData(current, fields, nil)
 }
+
+func (inj *Inject) StructPartialCtx(ctx context.Context, current interface{}, fields ...string) error {
+	return inj.structPartial(ctx, current, fields, nil)
+}
+
 func (inj *Inject) StructPartialWithCtxData(current interface{}, fields []string, ctxData map[string]interface{}) error {
+	return inj.structPartial(context.Background(), current, fields, ctxData)
+}
+
+func (inj *Inject) structPartial(ctx context.Context, current interface{}, fields []string, ctxData map[string]interface{}) error {
 	inj.initCheck()
 
 	sv, _ := inj.ExtractType(reflect.ValueOf(current))
@@ -258,7 +391,7 @@ func (inj *Inject) StructPartialWithCtxData(current interface{}, fields []string
 		}
 	}
 
-	return inj.injectStruct(sv, sv, sv, blank, blank, true, len(m) != 0, false, m, ctxData)
+	return inj.injectStruct(ctx, sv, sv, sv, blank, blank, true, len(m) != 0, false, m, ctxData)
 }
 
 // 注入指定部分之外的字段
@@ -266,7 +399,15 @@ func (inj *Inject) StructExcept(current interface{}, fields ...string) error {
 	return inj.StructExceptWithCtxData(current, fields, nil)
 }
 
+func (inj *Inject) StructExceptCtx(ctx context.Context, current interface{}, fields ...string) error {
+	return inj.structExcept(ctx, current, fields, nil)
+}
+
 func (inj *Inject) StructExceptWithCtxData(current interface{}, fields []string, ctxData map[string]interface{}) error {
+	return inj.structExcept(context.Background(), current, fields, ctxData)
+}
+
+func (inj *Inject) structExcept(ctx context.Context, current interface{}, fields []string, ctxData map[string]interface{}) error {
 	inj.initCheck()
 
 	sv, _ := inj.ExtractType(reflect.ValueOf(current))
@@ -277,11 +418,7 @@ func (inj *Inject) StructExceptWithCtxData(current interface{}, fields []string,
 		m[name+namespaceSeparator+key] = struct{}{}
 	}
 
-	err := inj.injectStruct(sv, sv, sv, blank, blank, true, len(m) != 0, true, m, ctxData)
-	if err != nil {
-		return err
-	}
-	return nil
+	return inj.injectStruct(ctx, sv, sv, sv, blank, blank, true, len(m) != 0, true, m, ctxData)
 }
 
 // 结构体注入
@@ -290,17 +427,22 @@ func (inj *Inject) Struct(current interface{}) error {
 }
 
 func (inj *Inject) StructWithCtxData(current interface{}, ctxData map[string]interface{}) error {
+	return inj.StructCtxWithCtxData(context.Background(), current, ctxData)
+}
+
+// 结构体注入, ctx 结束后停止遍历并返回 ctx.Err(), resolver 可声明 context.Context 参数获取 ctx
+func (inj *Inject) StructCtx(ctx context.Context, current interface{}) error {
+	return inj.StructCtxWithCtxData(ctx, current, nil)
+}
+
+func (inj *Inject) StructCtxWithCtxData(ctx context.Context, current interface{}, ctxData map[string]interface{}) error {
 	inj.initCheck()
 	sv := reflect.ValueOf(current)
-	err := inj.injectStruct(sv, sv, sv, blank, blank, true, false, false, nil, ctxData)
-	if err != nil {
-		return err
-	}
-	return nil
+	return inj.injectStruct(ctx, sv, sv, sv, blank, blank, true, false, false, nil, ctxData)
 }
 
 // 结构体注入入口
-func (inj *Inject) injectStruct(topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, useStructName bool, partial bool, exclude bool, includeExclude map[string]struct{}, ctxData map[string]interface{}) *FieldError {
+func (inj *Inject) injectStruct(ctx context.Context, topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, useStructName bool, partial bool, exclude bool, includeExclude map[string]struct{}, ctxData map[string]interface{}) (err error) {
 
 	if current.Kind() == reflect.Ptr && !current.IsNil() {
 		current = current.Elem()
@@ -314,18 +456,48 @@ func (inj *Inject) injectStruct(topStruct reflect.Value, currentStruct reflect.V
 		panic("the value passed for injection must be able to be obtained with Addr")
 	}
 
-	return inj.traverseStruct(topStruct, currentStruct, current, errPrefix, nsPrefix, useStructName, partial, exclude, includeExclude, nil, nil, ctxData)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 结构体缓存在遍历时按需解析, 遇到 tag 定义错误时取消 traverseCtx 停止遍历, 返回 TagDefinitionErrors
+	traverseCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	call := &injectCall{ctx: traverseCtx, ctxData: ctxData, collectAll: inj.collectAllErrors, batch: &batchCache{}, memo: &memoCache{}, abort: &callAbort{cancel: cancel}}
+	if inj.maxConcurrency > 1 {
+		// 当前 goroutine 也参与注入, 所以令牌数少一个
+		call.sem = make(chan struct{}, inj.maxConcurrency-1)
+	}
+	fieldErr := inj.traverseStruct(topStruct, currentStruct, current, errPrefix, nsPrefix, useStructName, partial, exclude, includeExclude, nil, nil, call)
+	if call.abort.defErrs != nil {
+		return call.abort.defErrs
+	}
+	// ctx 结束时 resolver 返回的错误多半由此引起, 两种模式都返回 ctx.Err()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if fieldErr != nil {
+		return fieldErr
+	}
+	if len(call.errs) > 0 {
+		return call.errs
+	}
+	return nil
 }
 
 // 遍历结构体所有字段, 并传入traverseField
-func (inj *Inject) traverseStruct(topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, useStructName bool, partial bool, exclude bool, includeExclude map[string]struct{}, cs *cStruct, ct *cTag, ctxData map[string]interface{}) *FieldError {
+func (inj *Inject) traverseStruct(topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, useStructName bool, partial bool, exclude bool, includeExclude map[string]struct{}, cs *cStruct, ct *cTag, call *injectCall) *FieldError {
 	var ok bool
 	first := len(nsPrefix) == 0
-	typ := current.Type()
 
-	cs, ok = inj.structCache.Get(typ)
-	if !ok {
-		cs = inj.extractStructCache(current, typ.Name(), map[string]interface{}{})
+	cs, defErrs := inj.getStructCache(current)
+	if defErrs != nil {
+		// 由 injectStruct 返回 defErrs
+		call.abort.fail(defErrs)
+		return nil
 	}
 
 	if useStructName {
@@ -340,22 +512,33 @@ func (inj *Inject) traverseStruct(topStruct reflect.Value, currentStruct reflect
 	// but must still check and run below struct level injection
 	// if present
 	if first || ct == nil || ct.typeof != typeStructOnly {
-		for _, idx := range cs.order {
-			f := cs.fields[idx]
+		if call.sem != nil && cs.concurrent && len(cs.order) > 1 {
+			e := inj.traverseFieldsConcurrently(topStruct, currentStruct, current, errPrefix, nsPrefix, partial, exclude, includeExclude, cs, call)
+			if e != nil {
+				return e
+			}
+		} else {
+			for _, idx := range cs.order {
+				if call.ctx.Err() != nil {
+					// 已取消, 由 injectStruct 返回 ctx.Err()
+					return nil
+				}
+				f := cs.fields[idx]
 
-			if partial {
+				if partial {
 
-				_, ok = includeExclude[errPrefix+f.Name]
+					_, ok = includeExclude[errPrefix+f.Name]
 
-				if (ok && exclude) || (!ok && !exclude) {
-					continue
+					if (ok && exclude) || (!ok && !exclude) {
+						continue
+					}
+				}
+				e := inj.traverseField(topStruct, currentStruct, current.Field(f.Idx), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, f, f.cTags, call)
+				if e != nil && !call.collect(e) {
+					return e
 				}
-			}
-			e := inj.traverseField(topStruct, currentStruct, current.Field(f.Idx), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, f, f.cTags, ctxData)
-			if e != nil {
-				return e
-			}
 
+			}
 		}
 	}
 
@@ -367,11 +550,14 @@ func (inj *Inject) traverseStruct(topStruct reflect.Value, currentStruct reflect
 }
 
 // 遍历某字段的tag, 执行相应的注入函数
-func (inj *Inject) traverseField(topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, partial bool, exclude bool, includeExclude map[string]struct{}, cs *cStruct, cf *cField, ct *cTag, ctxData map[string]interface{}) *FieldError {
+func (inj *Inject) traverseField(topStruct reflect.Value, currentStruct reflect.Value, current reflect.Value, errPrefix string, nsPrefix string, partial bool, exclude bool, includeExclude map[string]struct{}, cs *cStruct, cf *cField, ct *cTag, call *injectCall) *FieldError {
 
 	var newVal reflect.Value = current
 	var tagFnErr error
 
+	// current 下面会被解引用(指针, 接口), 而 tag 函数收到和返回的都是原始字段的值,
+	// 回写必须用原始字段, 否则非 nil 的指针或接口字段会因类型不匹配 panic
+	field := current
 	var set = ct != nil && ct.fn != nil
 	defer func() {
 		if set {
@@ -379,7 +565,7 @@ func (inj *Inject) traverseField(topStruct reflect.Value, currentStruct reflect.
 				if !newVal.IsValid() {
 					panic(fmt.Sprintf("tagFnErr is nil, but newVal is invalid, %#v", ct))
 				}
-				current.Set(newVal)
+				field.Set(newVal)
 			}
 		}
 	}()
@@ -448,7 +634,7 @@ func (inj *Inject) traverseField(topStruct reflect.Value, currentStruct reflect.
 				return nil
 			}
 
-			nestedStructError := inj.traverseStruct(topStruct, current, current, errPrefix+cf.Name+namespaceSeparator, nsPrefix+cf.AltName+namespaceSeparator, false, partial, exclude, includeExclude, cs, ct, ctxData)
+			nestedStructError := inj.traverseStruct(topStruct, current, current, errPrefix+cf.Name+namespaceSeparator, nsPrefix+cf.AltName+namespaceSeparator, false, partial, exclude, includeExclude, cs, ct, call)
 			if nestedStructError != nil {
 				return nestedStructError
 			}
@@ -486,22 +672,27 @@ OUTER:
 
 			ct = ct.next
 
+			inj.prefetchBatch(current, kind, call)
+
 			// traverse slice or map here
 			// or panic ;)
 			switch kind {
 			case reflect.Slice, reflect.Array:
 
-				for i := 0; i < current.Len(); i++ {
-					e := inj.traverseField(topStruct, currentStruct, current.Index(i), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, &cField{Name: fmt.Sprintf(arrayIndexFieldName, cf.Name, i), AltName: fmt.Sprintf(arrayIndexFieldName, cf.AltName, i)}, ct, ctxData)
-					if e != nil {
+				for i := 0; i < current.Len() && call.ctx.Err() == nil; i++ {
+					e := inj.traverseField(topStruct, currentStruct, current.Index(i), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, &cField{Name: fmt.Sprintf(arrayIndexFieldName, cf.Name, i), AltName: fmt.Sprintf(arrayIndexFieldName, cf.AltName, i)}, ct, call)
+					if e != nil && !call.collect(e) {
 						return e
 					}
 				}
 
 			case reflect.Map:
 				for _, key := range current.MapKeys() {
-					e := inj.traverseField(topStruct, currentStruct, current.MapIndex(key), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, &cField{Name: fmt.Sprintf(mapIndexFieldName, cf.Name, key.Interface()), AltName: fmt.Sprintf(mapIndexFieldName, cf.AltName, key.Interface())}, ct, ctxData)
-					if e != nil {
+					if call.ctx.Err() != nil {
+						break
+					}
+					e := inj.traverseField(topStruct, currentStruct, current.MapIndex(key), errPrefix, nsPrefix, partial, exclude, includeExclude, cs, &cField{Name: fmt.Sprintf(mapIndexFieldName, cf.Name, key.Interface()), AltName: fmt.Sprintf(mapIndexFieldName, cf.AltName, key.Interface())}, ct, call)
+					if e != nil && !call.collect(e) {
 						return e
 					}
 				}
@@ -524,7 +715,9 @@ OUTER:
 					CurrentStruct: currentStruct,
 					Field:         newVal,
 					Param:         ct.param,
-					CtxData:       ctxData,
+					CtxData:       call.ctxData,
+					Ctx:           call.ctx,
+					call:          call,
 				})
 				if tagFnErr == nil {
 
@@ -577,8 +770,6 @@ OUTER:
 							InjectError:    tagFnErr,
 						}
 					}
-
-					return nil
 				}
 
 				ct = ct.next
@@ -590,7 +781,9 @@ OUTER:
 				CurrentStruct: currentStruct,
 				Field:         newVal,
 				Param:         ct.param,
-				CtxData:       ctxData,
+				CtxData:       call.ctxData,
+				Ctx:           call.ctx,
+				call:          call,
 			})
 
 			if tagFnErr != nil {
@@ -610,9 +803,6 @@ OUTER:
 					Kind:           kind,
 					InjectError:    tagFnErr,
 				}
-
-				return nil
-
 			}
 
 			ct = ct.next
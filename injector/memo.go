@@ -0,0 +1,103 @@
+package injector
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// 注册的 resolver 信息, 同时作为缓存 key 中 resolver 的标识
+type resolverInfo struct {
+	name string
+	typ  reflect.Type
+}
+
+type memoKey struct {
+	resolver *resolverInfo
+	args     interface{} // [n]interface{}, 可比较
+}
+
+type memoEntry struct {
+	done  chan struct{}
+	value reflect.Value
+	err   error
+}
+
+// 单次注入调用内的 resolver 结果缓存, 相同 resolver 和参数只计算一次
+type memoCache struct {
+	mu      sync.Mutex
+	entries map[memoKey]*memoEntry
+}
+
+// 注入器累计的缓存命中统计
+type MemoStats struct {
+	Hits   int64
+	Misses int64
+}
+
+func (inj *Inject) MemoStats() MemoStats {
+	return MemoStats{
+		Hits:   atomic.LoadInt64(&inj.memoHits),
+		Misses: atomic.LoadInt64(&inj.memoMisses),
+	}
+}
+
+// 参数不可比较时返回 false, 此时不缓存
+func newMemoKey(resolver *resolverInfo, args []reflect.Value) (memoKey, bool) {
+	arr := reflect.New(reflect.ArrayOf(len(args), typInterface)).Elem()
+	for i, arg := range args {
+		if !arg.IsValid() || !comparableValue(arg) {
+			return memoKey{}, false
+		}
+		arr.Index(i).Set(arg)
+	}
+	return memoKey{resolver: resolver, args: arr.Interface()}, true
+}
+
+// v 可以作为 map key, 接口类型时判断其动态类型
+func comparableValue(v reflect.Value) bool {
+	if !v.Type().Comparable() {
+		return false
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		return v.Elem().Type().Comparable()
+	}
+	return true
+}
+
+// 命中时等待并返回已有结果, 否则执行 fn 并缓存, 并发调用同一个 key 时只执行一次.
+// fn panic 时转为错误缓存, 所有调用方都得到该错误
+func (c *memoCache) do(inj *Inject, key memoKey, fn func() (reflect.Value, error)) (value reflect.Value, err error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[memoKey]*memoEntry{}
+	}
+	if e, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		atomic.AddInt64(&inj.memoHits, 1)
+		<-e.done
+		return e.value, e.err
+	}
+	e := &memoEntry{done: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	atomic.AddInt64(&inj.memoMisses, 1)
+	defer func() {
+		if p := recover(); p != nil {
+			// 与未缓存时一致, panic 的值是 error 时保留, errors.Is 仍然可用
+			if pErr, ok := p.(error); ok {
+				e.err = errors.WithMessage(pErr, "paniked")
+			} else {
+				e.err = errors.New(fmt.Sprintf("paniked: %v", p))
+			}
+			e.value = reflect.Value{}
+		}
+		close(e.done)
+		value, err = e.value, e.err
+	}()
+	e.value, e.err = fn()
+	return
+}
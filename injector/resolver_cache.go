@@ -0,0 +1,169 @@
+package injector
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// 跨注入调用的 resolver 结果缓存, key 为可比较的值, 可直接作为 map key
+type ResolverCache interface {
+	Get(key interface{}) (value interface{}, ok bool)
+	// ttl <= 0 表示不过期
+	Set(key interface{}, value interface{}, ttl time.Duration)
+	Delete(key interface{})
+}
+
+type resolverCacheKey struct {
+	resolver *resolverInfo // 每个注册的 resolver 唯一, 不同名称或同名不同签名的 resolver 互不干扰
+	args     interface{}   // [n]interface{}
+}
+
+type resolverCacheConfig struct {
+	cache ResolverCache
+	ttl   time.Duration
+}
+
+// 为指定名称的 resolver 配置缓存, 只缓存成功的结果; cache 为 nil 时取消缓存.
+// 多个 resolver 可以共用一个 cache. 使用 @nocache 的 by tag, 参数含 *TagFnState 或参数不可比较的 resolver 不经过缓存
+func (inj *Inject) SetResolverCache(resolverName string, cache ResolverCache, ttl time.Duration) {
+	inj.resolverCacheMu.Lock()
+	defer inj.resolverCacheMu.Unlock()
+	if cache == nil {
+		delete(inj.resolverCaches, resolverName)
+		return
+	}
+	if inj.resolverCaches == nil {
+		inj.resolverCaches = map[string]*resolverCacheConfig{}
+	}
+	inj.resolverCaches[resolverName] = &resolverCacheConfig{cache: cache, ttl: ttl}
+}
+
+// 删除指定名称 resolver 以 args 为参数的缓存结果, args 的类型需与 by 引用字段的类型一致
+func (inj *Inject) InvalidateResolver(resolverName string, args ...interface{}) {
+	inj.resolverCacheMu.RLock()
+	cfg := inj.resolverCaches[resolverName]
+	infos := inj.resolverInfos[resolverName]
+	inj.resolverCacheMu.RUnlock()
+	if cfg == nil {
+		return
+	}
+
+	arr := reflect.New(reflect.ArrayOf(len(args), typInterface)).Elem()
+	for i, arg := range args {
+		if arg != nil {
+			arr.Index(i).Set(reflect.ValueOf(arg))
+		}
+	}
+	for _, info := range infos {
+		cfg.cache.Delete(resolverCacheKey{resolver: info, args: arr.Interface()})
+	}
+}
+
+func (inj *Inject) addResolverInfo(info *resolverInfo) {
+	inj.resolverCacheMu.Lock()
+	defer inj.resolverCacheMu.Unlock()
+	if inj.resolverInfos == nil {
+		inj.resolverInfos = map[string][]*resolverInfo{}
+	}
+	inj.resolverInfos[info.name] = append(inj.resolverInfos[info.name], info)
+}
+
+// resolver 配置了缓存时, 包装 fn 先查缓存
+func (inj *Inject) cachedResolve(info *resolverInfo, key memoKey, fn func() (reflect.Value, error)) func() (reflect.Value, error) {
+	inj.resolverCacheMu.RLock()
+	cfg := inj.resolverCaches[info.name]
+	inj.resolverCacheMu.RUnlock()
+	if cfg == nil {
+		return fn
+	}
+
+	cacheKey := resolverCacheKey{resolver: info, args: key.args}
+	return func() (reflect.Value, error) {
+		if v, ok := cfg.cache.Get(cacheKey); ok {
+			if v == nil {
+				return reflect.Zero(info.typ.Out(0)), nil
+			}
+			return reflect.ValueOf(v), nil
+		}
+		value, err := fn()
+		if err == nil {
+			cfg.cache.Set(cacheKey, value.Interface(), cfg.ttl)
+		}
+		return value, err
+	}
+}
+
+type lruEntry struct {
+	key      interface{}
+	value    interface{}
+	expireAt time.Time
+}
+
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[interface{}]*list.Element
+}
+
+// 创建内存 LRU 缓存, 最多保存 size 个结果
+func NewLRUResolverCache(size int) ResolverCache {
+	if size <= 0 {
+		panic("lru cache size must be positive")
+	}
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: map[interface{}]*list.Element{},
+	}
+}
+
+func (c *lruCache) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *lruCache) Set(key interface{}, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expireAt = value, expireAt
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruCache) Delete(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
@@ -0,0 +1,169 @@
+package injector
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 校验类 tag: 不修改字段的值, 校验失败时返回错误
+
+var regEmail = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+func requiredTag(state *TagFnState) TagFn {
+	return func(state *TagFnState) (value reflect.Value, err error) {
+		if !state.Field.IsValid() || state.Field.IsZero() {
+			return state.Field, errors.New("value is required")
+		}
+		return state.Field, nil
+	}
+}
+
+func minTag(state *TagFnState) TagFn {
+	return sizeTag(state, "min", func(cmp int) bool { return cmp >= 0 }, "less than")
+}
+
+func maxTag(state *TagFnState) TagFn {
+	return sizeTag(state, "max", func(cmp int) bool { return cmp <= 0 }, "greater than")
+}
+
+func lenTag(state *TagFnState) TagFn {
+	return sizeTag(state, "len", func(cmp int) bool { return cmp == 0 }, "not equal to")
+}
+
+// 数字比较值本身, 字符串比较字符数, 切片/数组/map 比较长度. 指针字段为 nil 时视为未填写, 不校验, 需要时配合 required
+func sizeTag(state *TagFnState, tag string, ok func(cmp int) bool, failMsg string) TagFn {
+	if len(state.Param) == 0 {
+		panic(fmt.Sprintf("%s tag need a param", tag))
+	}
+
+	typ := state.Field.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var compare func(v reflect.Value) int
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		limit := asInt(state.Param)
+		compare = func(v reflect.Value) int {
+			return compareInt64(v.Int(), limit)
+		}
+	case reflect.Uint, reflect.Uintptr, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		limit := asUint(state.Param)
+		compare = func(v reflect.Value) int {
+			switch n := v.Uint(); {
+			case n < limit:
+				return -1
+			case n > limit:
+				return 1
+			}
+			return 0
+		}
+	case reflect.Float32, reflect.Float64:
+		limit := asFloat(state.Param)
+		compare = func(v reflect.Value) int {
+			switch n := v.Float(); {
+			case n < limit:
+				return -1
+			case n > limit:
+				return 1
+			}
+			return 0
+		}
+	case reflect.String:
+		limit := asInt(state.Param)
+		compare = func(v reflect.Value) int {
+			return compareInt64(int64(utf8.RuneCountInString(v.String())), limit)
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		limit := asInt(state.Param)
+		compare = func(v reflect.Value) int {
+			return compareInt64(int64(v.Len()), limit)
+		}
+	default:
+		panic(fmt.Sprintf("%s tag not supported for %s", tag, typ.Kind()))
+	}
+
+	param := state.Param
+	return func(state *TagFnState) (value reflect.Value, err error) {
+		v := state.Field
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return state.Field, nil
+			}
+			v = v.Elem()
+		}
+		if !ok(compare(v)) {
+			return state.Field, errors.Errorf("[%v] is %s %s", v.Interface(), failMsg, param)
+		}
+		return state.Field, nil
+	}
+}
+
+func compareInt64(n, limit int64) int {
+	switch {
+	case n < limit:
+		return -1
+	case n > limit:
+		return 1
+	}
+	return 0
+}
+
+func regexTag(state *TagFnState) TagFn {
+	if len(state.Param) == 0 {
+		panic("regex tag need a param")
+	}
+	reg := regexp.MustCompile(strings.Replace(strings.Replace(state.Param, utf8HexComma, ",", -1), utf8Pipe, "|", -1))
+	return stringTag(state, "regex", func(s string) error {
+		if !reg.MatchString(s) {
+			return errors.Errorf("[%s] does not match %s", s, reg.String())
+		}
+		return nil
+	})
+}
+
+func emailTag(state *TagFnState) TagFn {
+	return stringTag(state, "email", func(s string) error {
+		if !regEmail.MatchString(s) {
+			return errors.Errorf("[%s] is not a valid email", s)
+		}
+		return nil
+	})
+}
+
+func urlTag(state *TagFnState) TagFn {
+	return stringTag(state, "url", func(s string) error {
+		u, err := url.ParseRequestURI(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("[%s] is not a valid url", s)
+		}
+		return nil
+	})
+}
+
+// 字符串字段的校验 tag, 支持 *string, 为 nil 时不校验
+func stringTag(state *TagFnState, tag string, check func(s string) error) TagFn {
+	typ := state.Field.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.String {
+		panic(fmt.Sprintf("%s tag not supported for %s", tag, state.Field.Kind()))
+	}
+	return func(state *TagFnState) (value reflect.Value, err error) {
+		v := state.Field
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return state.Field, nil
+			}
+			v = v.Elem()
+		}
+		return state.Field, check(v.String())
+	}
+}
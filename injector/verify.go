@@ -0,0 +1,80 @@
+package injector
+
+import (
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 检查注入器中一组结构体类型(及其嵌套结构体)的 tag 定义, 用于在测试或 CI 中提前发现:
+// 未注册的 tag, by 引用不存在的字段, 找不到匹配签名的 resolver, default/enum 用在不支持的字段类型上等.
+// types 可以是结构体值, 结构体指针(包括 nil 指针)或 reflect.Type
+func Verify(inj *Inject, types ...interface{}) error {
+	inj.initCheck()
+
+	var errs TagDefinitionErrors
+	visited := map[reflect.Type]bool{}
+	for _, t := range types {
+		typ, ok := t.(reflect.Type)
+		if !ok {
+			typ = reflect.TypeOf(t)
+		}
+		if typ == nil {
+			return errors.New("verify type must not be nil")
+		}
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return errors.Errorf("verify type %s is not a struct", typ)
+		}
+		inj.collectDefinitionErrors(typ, visited, &errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// 内置的 tag 名称, 包括 dive 等控制 tag
+func BakedInTagNames() []string {
+	var names []string
+	for name := range bakedInInjectorsInit {
+		names = append(names, name)
+	}
+	for name := range bakedInAliasInjectors {
+		names = append(names, name)
+	}
+	names = append(names, diveTag, omitempty, structOnlyTag, noStructLevelTag, existsTag)
+	sort.Strings(names)
+	return names
+}
+
+// tag 中的一项, 如 enum=a,b 的 Name 为 enum, Param 为 a,b
+type TagItem struct {
+	Name  string
+	Param string
+}
+
+// SplitTag 按注入时的规则拆分 tag: ";" 分隔依次执行的各段, 每段按 "|" 拆为 or 的候选项. 不展开别名
+func SplitTag(tag string) [][]TagItem {
+	var groups [][]TagItem
+	for _, t := range strings.Split(tag, tagSeparator) {
+		groups = append(groups, splitOrTag(t))
+	}
+	return groups
+}
+
+func splitOrTag(t string) []TagItem {
+	var items []TagItem
+	for _, or := range strings.Split(t, orSeparator) {
+		vals := strings.SplitN(or, tagKeySeparator, 2)
+		item := TagItem{Name: vals[0]}
+		if len(vals) > 1 {
+			item.Param = vals[1]
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -3,107 +3,61 @@ package app
 import (
 	"context"
 	"os"
-	"os/signal"
-	"sync"
 	"syscall"
-	"time"
 )
 
-var (
-	exitHooks   []func(ctx context.Context)
-	ctx, cancel = context.WithCancel(context.Background())
-	taskWg      sync.WaitGroup
+// 默认的 Manager, 包级函数都作用于它, 收到 SIGINT/SIGTERM 时退出.
+// 通过 OnReload 注册 hook 后, 收到 SIGHUP 时执行 reload hook, 没有 hook 时 SIGHUP 保持默认行为
+var std = New(
+	WithSignals(os.Interrupt, syscall.SIGINT, syscall.SIGTERM),
+	WithReloadSignals(syscall.SIGHUP),
 )
 
-func OnExit(fn func(ctx context.Context)) {
-	exitHooks = append(exitHooks, fn)
+func Default() *Manager {
+	return std
 }
 
-func Context() context.Context {
-	return ctx
+// Configure 修改默认 Manager 的选项, 如 WithTimeout, WithStacks, WithTimeoutReport, 需在开始退出前调用
+func Configure(opts ...Option) {
+	std.Configure(opts...)
 }
 
-func Done() bool {
-	select {
-	case <-ctx.Done():
-		return true
-	default:
-		return false
-	}
+func OnExit(fn func(ctx context.Context), opts ...HookOption) {
+	std.OnExit(fn, opts...)
 }
 
-func TaskStart() func() {
-	var once sync.Once
-	taskWg.Add(1)
-	return func() {
-		once.Do(func() {
-			taskWg.Done()
-		})
-	}
+func OnExitE(fn func(ctx context.Context) error, opts ...HookOption) {
+	std.OnExitE(fn, opts...)
 }
 
-var exitOnce sync.Once
-
-func Exit() {
-	println("existing... caused by manual exit call")
-	exitOnce.Do(func() {
-		cancel()
-		doExit()
-	})
+func Context() context.Context {
+	return std.Context()
 }
 
-func init() {
-	shutDownCh := make(chan os.Signal, 3)
-	signal.Notify(shutDownCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		sig := <-shutDownCh
-		println("existing... caused by signal: ", sig.String())
-		exitOnce.Do(func() {
-			cancel()
-			doExit()
-		})
-	}()
+func Done() bool {
+	return std.Done()
 }
 
-func doExit() {
-	timeout, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func TaskStart(name ...string) func() {
+	return std.TaskStart(name...)
+}
 
-	var hookWg sync.WaitGroup
-	hookWg.Add(len(exitHooks))
-	for _, hook := range exitHooks {
-		go func(hook func(ctx context.Context)) {
-			defer hookWg.Done()
-			hook(timeout)
-		}(hook)
-	}
+func Exit() {
+	std.Exit()
+}
 
-	var hookWgDone = waitWg(&hookWg)
-	var taskWgDone = waitWg(&taskWg)
+func Register(name string, c Component, dependsOn ...string) error {
+	return std.Register(name, c, dependsOn...)
+}
 
-	select {
-	case <-timeout.Done():
-		println("tasks finished timeout")
-		os.Exit(-1)
-	case <-taskWgDone:
-		println("all tasks finished")
-	}
+func Start(ctx context.Context) error {
+	return std.Start(ctx)
+}
 
-	select {
-	case <-timeout.Done():
-		println("exit hooks timeout")
-		os.Exit(-1)
-	case <-hookWgDone:
-		println("all exit hooks returned, exit now")
-		os.Exit(0)
-	}
+func OnReload(fn func(ctx context.Context) error) {
+	std.OnReload(fn)
 }
 
-func waitWg(wg *sync.WaitGroup) <-chan struct{} {
-	ch := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-	return ch
+func Reload() error {
+	return std.Reload()
 }
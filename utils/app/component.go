@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Component 由 Manager 按依赖顺序启动, 退出时按相反顺序停止
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+type funcComponent struct {
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+func (c *funcComponent) Start(ctx context.Context) error {
+	if c.start == nil {
+		return nil
+	}
+	return c.start(ctx)
+}
+
+func (c *funcComponent) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop(ctx)
+}
+
+// NewComponent 由函数生成 Component, start 和 stop 都可以为 nil
+func NewComponent(start, stop func(ctx context.Context) error) Component {
+	return &funcComponent{start: start, stop: stop}
+}
+
+type component struct {
+	name string
+	c    Component
+	deps []string
+}
+
+// Register 注册组件, dependsOn 中的组件会先于它启动, 后于它停止. 必须在 Start 前调用
+func (m *Manager) Register(name string, c Component, dependsOn ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.componentsStarted {
+		return errors.New("register component " + name + " after start")
+	}
+	for _, comp := range m.components {
+		if comp.name == name {
+			return errors.New("component " + name + " already registered")
+		}
+	}
+	m.components = append(m.components, &component{name: name, c: c, deps: dependsOn})
+	return nil
+}
+
+// Start 按依赖顺序启动所有组件, 某个组件启动失败时按相反顺序停止已启动的组件并返回错误, 之后可以再次调用 Start.
+// 启动成功的组件在退出时, 所有退出 hook 返回后按相反顺序停止, 启动过程中开始退出时也是如此
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if m.componentsStarted {
+		m.mu.Unlock()
+		return errors.New("components already started")
+	}
+	order, err := sortComponents(m.components)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.componentsStarted = true
+	m.mu.Unlock()
+
+	for _, comp := range order {
+		if err = comp.c.Start(ctx); err != nil {
+			err = errors.Wrap(err, "start component "+comp.name+" error")
+			break
+		}
+		m.mu.Lock()
+		m.started = append(m.started, comp)
+		m.mu.Unlock()
+	}
+	if err == nil {
+		return nil
+	}
+
+	// 退出时已经停止的组件不在 m.started 中
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.componentsStarted = false
+	m.mu.Unlock()
+	stopCtx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	for _, stopErr := range m.stopAll(stopCtx, started) {
+		m.logger.Println("rollback:", stopErr)
+	}
+	return err
+}
+
+// 退出时停止已启动的组件
+func (m *Manager) stopComponents(ctx context.Context) []error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+	return m.stopAll(ctx, started)
+}
+
+// 按相反顺序停止组件, 记录正在停止的组件用于超时报告
+func (m *Manager) stopAll(ctx context.Context, started []*component) []error {
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		comp := started[i]
+		m.mu.Lock()
+		m.stopping, m.stoppingAt = comp, time.Now()
+		m.mu.Unlock()
+		err := comp.c.Stop(ctx)
+		m.mu.Lock()
+		m.stopping = nil
+		m.mu.Unlock()
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "stop component "+comp.name+" error"))
+		}
+	}
+	return errs
+}
+
+// 按依赖拓扑排序, 无依赖关系的组件保持注册顺序
+func sortComponents(components []*component) ([]*component, error) {
+	byName := make(map[string]*component, len(components))
+	for _, comp := range components {
+		byName[comp.name] = comp
+	}
+	pending := make(map[*component]int, len(components))
+	dependents := make(map[string][]*component)
+	for _, comp := range components {
+		for _, dep := range comp.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, errors.New("component " + comp.name + " depends on unknown component " + dep)
+			}
+			pending[comp]++
+			dependents[dep] = append(dependents[dep], comp)
+		}
+	}
+
+	var order []*component
+	done := make(map[*component]bool, len(components))
+	for len(order) < len(components) {
+		progressed := false
+		for _, comp := range components {
+			if done[comp] || pending[comp] > 0 {
+				continue
+			}
+			done[comp] = true
+			order = append(order, comp)
+			for _, d := range dependents[comp.name] {
+				pending[d]--
+			}
+			progressed = true
+			break
+		}
+		if !progressed {
+			for _, comp := range components {
+				if !done[comp] {
+					return nil, errors.New("component dependency cycle at " + comp.name)
+				}
+			}
+		}
+	}
+	return order, nil
+}
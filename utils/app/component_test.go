@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponentStartRetry(t *testing.T) {
+	exitCode := make(chan int, 1)
+	m := New(
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithExitFunc(func(code int) {
+			exitCode <- code
+		}),
+	)
+	var events []string
+	var failCache bool
+	comp := func(name string, fail *bool) Component {
+		return NewComponent(func(ctx context.Context) error {
+			if fail != nil && *fail {
+				return errors.New("unavailable")
+			}
+			events = append(events, "start "+name)
+			return nil
+		}, func(ctx context.Context) error {
+			events = append(events, "stop "+name)
+			return nil
+		})
+	}
+	assert.NoError(t, m.Register("cache", comp("cache", &failCache), "db"))
+	assert.NoError(t, m.Register("db", comp("db", nil)))
+
+	failCache = true
+	assert.Error(t, m.Start(context.Background()))
+	assert.Equal(t, []string{"start db", "stop db"}, events)
+
+	// 失败后可以重试
+	failCache = false
+	events = nil
+	assert.NoError(t, m.Start(context.Background()))
+	assert.Error(t, m.Start(context.Background()))
+
+	m.Exit()
+	assert.Equal(t, 0, <-exitCode)
+	assert.Equal(t, []string{"start db", "start cache", "stop cache", "stop db"}, events)
+}
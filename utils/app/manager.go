@@ -0,0 +1,360 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultExitTimeout = 3 * time.Second
+
+// Manager 管理应用的生命周期: 退出信号, 退出前需要等待的 task 和退出 hook
+type Manager struct {
+	timeout       time.Duration
+	signals       []os.Signal
+	reloadSignals []os.Signal
+	exitFunc      func(code int)
+	logger        *log.Logger
+
+	stacks    bool
+	onTimeout func(report *ExitReport)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu                sync.Mutex
+	hooks             []*exitHook
+	components        []*component
+	started           []*component
+	componentsStarted bool
+	tasks             map[*task]struct{}
+	stopping          *component
+	stoppingAt        time.Time
+	reloadHooks       []func(ctx context.Context) error
+
+	reloadMu sync.Mutex
+
+	// 信号的接收 channel, 监听的信号可以通过 Configure 修改
+	signalOnce  sync.Once
+	signalCh    chan os.Signal
+	reloadOnce  sync.Once
+	reloadSigCh chan os.Signal
+
+	taskWg   sync.WaitGroup
+	exitOnce sync.Once
+}
+
+type Option func(m *Manager)
+
+// 退出时等待 task 和 hook 的总超时, 默认 3 秒
+func WithTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.timeout = timeout
+	}
+}
+
+// 收到这些信号时退出, 退出过程中再次收到时立即以 -1 退出. 默认不监听信号
+func WithSignals(signals ...os.Signal) Option {
+	return func(m *Manager) {
+		m.signals = signals
+	}
+}
+
+// 收到这些信号时执行 OnReload 注册的 hook, 注册了 hook 后才开始监听. 默认不监听信号
+func WithReloadSignals(signals ...os.Signal) Option {
+	return func(m *Manager) {
+		m.reloadSignals = signals
+	}
+}
+
+// 退出流程结束后以退出码调用, 默认为 os.Exit
+func WithExitFunc(fn func(code int)) Option {
+	return func(m *Manager) {
+		m.exitFunc = fn
+	}
+}
+
+func WithLogger(logger *log.Logger) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+func New(opts ...Option) *Manager {
+	m := &Manager{
+		timeout:     defaultExitTimeout,
+		exitFunc:    os.Exit,
+		logger:      log.Default(),
+		tasks:       map[*task]struct{}{},
+		signalCh:    make(chan os.Signal, 3),
+		reloadSigCh: make(chan os.Signal, 1),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.Configure(opts...)
+	return m
+}
+
+// Configure 修改 Manager 的选项, 如超时, 日志, 监听的信号和超时报告, 需在开始退出前调用
+func (m *Manager) Configure(opts ...Option) {
+	m.mu.Lock()
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.mu.Unlock()
+	m.notifySignals()
+	m.notifyReloadSignals()
+}
+
+type exitHook struct {
+	fn       func(ctx context.Context) error
+	name     string
+	priority int
+	timeout  time.Duration
+	stack    string
+
+	// 退出时的执行状态, 由 Manager.mu 保护
+	startedAt time.Time
+	finished  bool
+}
+
+type HookOption func(h *exitHook)
+
+// hook 的名称, 用于错误和超时报告
+func HookName(name string) HookOption {
+	return func(h *exitHook) {
+		h.name = name
+	}
+}
+
+// 优先级高的 hook 先执行, 全部返回后才执行下一优先级, 同优先级的 hook 并发执行. 默认为 0
+func Priority(priority int) HookOption {
+	return func(h *exitHook) {
+		h.priority = priority
+	}
+}
+
+// hook 单独的超时, 不会超过 Manager 的总超时
+func HookTimeout(timeout time.Duration) HookOption {
+	return func(h *exitHook) {
+		h.timeout = timeout
+	}
+}
+
+func (m *Manager) OnExit(fn func(ctx context.Context), opts ...HookOption) {
+	m.OnExitE(func(ctx context.Context) error {
+		fn(ctx)
+		return nil
+	}, opts...)
+}
+
+// OnExitE 注册返回错误的退出 hook, 有 hook 返回错误时退出码为 1
+func (m *Manager) OnExitE(fn func(ctx context.Context) error, opts ...HookOption) {
+	h := &exitHook{fn: fn, stack: m.captureStack()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	m.mu.Lock()
+	m.hooks = append(m.hooks, h)
+	m.mu.Unlock()
+}
+
+// Context 在开始退出时取消
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+func (m *Manager) Done() bool {
+	select {
+	case <-m.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// TaskStart 登记一个退出前需要等待完成的 task, 返回的函数标记 task 完成.
+// 可选的 name 用于超时报告
+func (m *Manager) TaskStart(name ...string) func() {
+	t := &task{name: strings.Join(name, " "), start: time.Now(), stack: m.captureStack()}
+	m.mu.Lock()
+	m.tasks[t] = struct{}{}
+	m.mu.Unlock()
+
+	var once sync.Once
+	m.taskWg.Add(1)
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.tasks, t)
+			m.mu.Unlock()
+			m.taskWg.Done()
+		})
+	}
+}
+
+func (m *Manager) Exit() {
+	m.exit("manual exit call")
+}
+
+func (m *Manager) exit(reason string) {
+	m.logger.Println("exiting... caused by", reason)
+	m.exitOnce.Do(func() {
+		m.cancel()
+		m.exitFunc(m.doExit())
+	})
+}
+
+// 按当前的 signals 重新订阅, 第一次有信号时启动接收的 goroutine
+func (m *Manager) notifySignals() {
+	m.mu.Lock()
+	signals := m.signals
+	m.mu.Unlock()
+	signal.Stop(m.signalCh)
+	if len(signals) == 0 {
+		return
+	}
+	signal.Notify(m.signalCh, signals...)
+	m.signalOnce.Do(func() {
+		go func() {
+			sig := <-m.signalCh
+			go m.exit("signal: " + sig.String())
+			for sig = range m.signalCh {
+				m.logger.Println("force exit caused by repeated signal:", sig.String())
+				m.exitFunc(-1)
+			}
+		}()
+	})
+}
+
+// 等待 task 完成和 hook 返回, 返回退出码
+func (m *Manager) doExit() int {
+	timeout, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var hooksDone = make(chan []error, 1)
+	go func() {
+		errs := m.runHooks(timeout)
+		hooksDone <- append(errs, m.stopComponents(timeout)...)
+	}()
+	var taskWgDone = waitWg(&m.taskWg)
+
+	select {
+	case <-timeout.Done():
+		m.logger.Println("tasks finished timeout")
+		m.reportTimeout()
+		return -1
+	case <-taskWgDone:
+		m.logger.Println("all tasks finished")
+	}
+
+	select {
+	case <-timeout.Done():
+		m.logger.Println("exit hooks timeout")
+		m.reportTimeout()
+		return -1
+	case errs := <-hooksDone:
+		if len(errs) > 0 {
+			for _, err := range errs {
+				m.logger.Println("exit hook error:", err)
+			}
+			return 1
+		}
+		m.logger.Println("all exit hooks returned, exit now")
+		return 0
+	}
+}
+
+func (m *Manager) reportTimeout() {
+	report := m.report()
+	m.logger.Print(report.String())
+	if m.onTimeout != nil {
+		m.onTimeout(report)
+	}
+}
+
+// 按优先级分组依次执行 hook
+func (m *Manager) runHooks(ctx context.Context) []error {
+	m.mu.Lock()
+	hooks := append([]*exitHook(nil), m.hooks...)
+	m.mu.Unlock()
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].priority > hooks[j].priority
+	})
+
+	var errs []error
+	for start := 0; start < len(hooks); {
+		end := start + 1
+		for end < len(hooks) && hooks[end].priority == hooks[start].priority {
+			end++
+		}
+		group := hooks[start:end]
+		groupErrs := make([]error, len(group))
+
+		var wg sync.WaitGroup
+		wg.Add(len(group))
+		for i, h := range group {
+			go func(i int, h *exitHook) {
+				defer wg.Done()
+				groupErrs[i] = m.runHook(ctx, h)
+			}(i, h)
+		}
+		wg.Wait()
+
+		for _, err := range groupErrs {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		start = end
+	}
+	return errs
+}
+
+// 超时后不再等待该 hook 返回, hook 真正返回时才标记为完成
+func (m *Manager) runHook(ctx context.Context, h *exitHook) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	m.mu.Lock()
+	h.startedAt = time.Now()
+	m.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			h.finished = true
+			m.mu.Unlock()
+		}()
+		defer func() {
+			if p := recover(); p != nil {
+				done <- errors.New(fmt.Sprintf("exit hook %s panic: %v", displayName(h.name), p))
+			}
+		}()
+		done <- h.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "exit hook "+displayName(h.name)+" timeout")
+	}
+}
+
+func waitWg(wg *sync.WaitGroup) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigure(t *testing.T) {
+	exitCode := make(chan int, 1)
+	m := New(WithExitFunc(func(code int) {
+		exitCode <- code
+	}))
+	var report *ExitReport
+	m.Configure(
+		WithTimeout(50*time.Millisecond),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithStacks(true),
+		WithTimeoutReport(func(r *ExitReport) {
+			report = r
+		}),
+	)
+
+	m.OnExit(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+	}, HookName("slow"))
+	start := time.Now()
+	m.Exit()
+	assert.Equal(t, -1, <-exitCode)
+	assert.Less(t, time.Since(start), time.Second)
+	if assert.NotNil(t, report) && assert.Len(t, report.Outstanding, 1) {
+		assert.Equal(t, "slow", report.Outstanding[0].Name)
+		assert.NotEmpty(t, report.Outstanding[0].Stack)
+	}
+}
+
+func TestTaskReport(t *testing.T) {
+	exitCode := make(chan int, 1)
+	var report *ExitReport
+	m := New(
+		WithTimeout(50*time.Millisecond),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithExitFunc(func(code int) {
+			exitCode <- code
+		}),
+		WithTimeoutReport(func(r *ExitReport) {
+			report = r
+		}),
+	)
+	m.TaskStart()()
+	m.TaskStart("finished")()
+	done := m.TaskStart("http", "worker")
+	defer done()
+
+	m.Exit()
+	assert.Equal(t, -1, <-exitCode)
+	if assert.NotNil(t, report) && assert.Len(t, report.Outstanding, 1) {
+		assert.Equal(t, "task", report.Outstanding[0].Kind)
+		assert.Equal(t, "http worker", report.Outstanding[0].Name)
+	}
+}
+
+func TestExitHooks(t *testing.T) {
+	exitCode := make(chan int, 1)
+	m := New(
+		WithTimeout(time.Second),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithExitFunc(func(code int) {
+			exitCode <- code
+		}),
+	)
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+
+	m.OnExit(func(ctx context.Context) { record("low") }, Priority(-5))
+	// 同优先级的 hook 并发执行, 互相等待也能完成
+	barrier := make(chan struct{})
+	for _, name := range []string{"a", "b"} {
+		name := name
+		m.OnExit(func(ctx context.Context) {
+			select {
+			case barrier <- struct{}{}:
+			case <-barrier:
+			}
+			record(name)
+		})
+	}
+	m.OnExit(func(ctx context.Context) { record("high") }, Priority(10))
+
+	start := time.Now()
+	m.Exit()
+	assert.Equal(t, 0, <-exitCode)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	if assert.Len(t, order, 4) {
+		assert.Equal(t, "high", order[0])
+		assert.ElementsMatch(t, []string{"a", "b"}, order[1:3])
+		assert.Equal(t, "low", order[3])
+	}
+}
+
+func TestExitHookError(t *testing.T) {
+	exitCode := make(chan int, 1)
+	m := New(
+		WithTimeout(time.Second),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithExitFunc(func(code int) {
+			exitCode <- code
+		}),
+	)
+	// 单个 hook 超时后继续执行下一优先级的 hook, 退出码为 1
+	m.OnExitE(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, HookName("stuck"), HookTimeout(20*time.Millisecond), Priority(1))
+	var next bool
+	m.OnExit(func(ctx context.Context) {
+		next = true
+	})
+
+	start := time.Now()
+	m.Exit()
+	assert.Equal(t, 1, <-exitCode)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.True(t, next)
+
+	exitCode = make(chan int, 1)
+	m = New(
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithExitFunc(func(code int) {
+			exitCode <- code
+		}),
+	)
+	m.OnExitE(func(ctx context.Context) error {
+		return errors.New("close db error")
+	})
+	m.Exit()
+	assert.Equal(t, 1, <-exitCode)
+}
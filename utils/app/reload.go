@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"os/signal"
+	"strings"
+)
+
+// OnReload 注册重新加载配置等的 hook, 收到 reload 信号或调用 Reload 时按注册顺序执行.
+// 注册第一个 hook 时才开始监听 reload 信号
+func (m *Manager) OnReload(fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	m.reloadHooks = append(m.reloadHooks, fn)
+	first := len(m.reloadHooks) == 1
+	m.mu.Unlock()
+	if first {
+		m.notifyReloadSignals()
+	}
+}
+
+// Reload 依次执行所有 reload hook, 多次调用串行执行. 单个 hook 失败不影响后续 hook, 错误会被记录并合并返回
+func (m *Manager) Reload() error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	m.mu.Lock()
+	hooks := append([]func(ctx context.Context) error(nil), m.reloadHooks...)
+	m.mu.Unlock()
+
+	var msgs []string
+	for i, fn := range hooks {
+		if err := runReloadHook(m.ctx, fn); err != nil {
+			m.logger.Println("reload hook error:", err)
+			msgs = append(msgs, fmt.Sprintf("reload hook %d: %s", i, err))
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func runReloadHook(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprintf("panic: %v", p))
+		}
+	}()
+	return fn(ctx)
+}
+
+// 按当前的 reloadSignals 重新订阅, 没有 reload hook 时不订阅, 以免改变信号的默认行为(如 SIGHUP 结束进程).
+// 第一次订阅时启动接收的 goroutine, 开始退出后不再订阅
+func (m *Manager) notifyReloadSignals() {
+	m.mu.Lock()
+	signals := m.reloadSignals
+	hasHooks := len(m.reloadHooks) > 0
+	m.mu.Unlock()
+	signal.Stop(m.reloadSigCh)
+	if len(signals) == 0 || !hasHooks || m.Done() {
+		return
+	}
+	signal.Notify(m.reloadSigCh, signals...)
+	m.reloadOnce.Do(func() {
+		go func() {
+			for {
+				select {
+				case <-m.ctx.Done():
+					signal.Stop(m.reloadSigCh)
+					return
+				case sig := <-m.reloadSigCh:
+					m.logger.Println("reloading... caused by signal:", sig.String())
+					_ = m.Reload()
+				}
+			}
+		}()
+	})
+}
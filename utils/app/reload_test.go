@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	m := New(
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithReloadSignals(syscall.SIGUSR1),
+	)
+	reloaded := make(chan int, 3)
+	m.OnReload(func(ctx context.Context) error {
+		reloaded <- 1
+		return errors.New("bad config")
+	})
+	m.OnReload(func(ctx context.Context) error {
+		reloaded <- 2
+		return nil
+	})
+
+	err := m.Reload()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad config")
+	}
+	assert.Equal(t, 1, <-reloaded)
+	assert.Equal(t, 2, <-reloaded)
+
+	// 注册 hook 后才监听 reload 信号
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case n := <-reloaded:
+		assert.Equal(t, 1, n)
+	case <-time.After(time.Second):
+		t.Fatal("reload signal not handled")
+	}
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 退出超时时仍未完成的 task, hook 或正在停止的组件
+type Outstanding struct {
+	Kind    string // task, hook 或 component
+	Name    string
+	Started bool          // hook 所在优先级组是否已开始执行, task 和组件总是 true
+	Age     time.Duration // 自 task 登记或 hook/组件开始执行至今的时间
+	Stack   string        // 登记时的调用栈, 开启 WithStacks 时才有
+}
+
+type ExitReport struct {
+	Outstanding []Outstanding
+	// 超时时所有 goroutine 的栈, 开启 WithStacks 时才有
+	Goroutines string
+}
+
+func (r *ExitReport) String() string {
+	var b strings.Builder
+	b.WriteString("exit timeout, outstanding:\n")
+	for _, o := range r.Outstanding {
+		b.WriteString("  " + o.Kind + " " + displayName(o.Name))
+		if o.Started {
+			b.WriteString(" running for " + o.Age.Round(time.Millisecond).String())
+		} else {
+			b.WriteString(" not started")
+		}
+		b.WriteString("\n")
+		if o.Stack != "" {
+			b.WriteString(indent(o.Stack, "    "))
+		}
+	}
+	if r.Goroutines != "" {
+		b.WriteString("goroutines:\n")
+		b.WriteString(indent(r.Goroutines, "  "))
+	}
+	return b.String()
+}
+
+// 开启后 task 登记和 hook 注册时记录调用栈, 超时报告中包含这些栈和所有 goroutine 的栈
+func WithStacks(enabled bool) Option {
+	return func(m *Manager) {
+		m.stacks = enabled
+	}
+}
+
+// 退出超时时, 在以 -1 退出前调用
+func WithTimeoutReport(fn func(report *ExitReport)) Option {
+	return func(m *Manager) {
+		m.onTimeout = fn
+	}
+}
+
+type task struct {
+	name  string
+	start time.Time
+	stack string
+}
+
+func (m *Manager) captureStack() string {
+	if !m.stacks {
+		return ""
+	}
+	return string(debug.Stack())
+}
+
+// 当前未完成的 task, hook 和正在停止的组件
+func (m *Manager) report() *ExitReport {
+	now := time.Now()
+	r := &ExitReport{}
+
+	m.mu.Lock()
+	var tasks []Outstanding
+	for t := range m.tasks {
+		tasks = append(tasks, Outstanding{Kind: "task", Name: t.name, Started: true, Age: now.Sub(t.start), Stack: t.stack})
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Age > tasks[j].Age
+	})
+	r.Outstanding = append(r.Outstanding, tasks...)
+	for _, h := range m.hooks {
+		if h.finished {
+			continue
+		}
+		o := Outstanding{Kind: "hook", Name: h.name, Started: !h.startedAt.IsZero(), Stack: h.stack}
+		if o.Started {
+			o.Age = now.Sub(h.startedAt)
+		}
+		r.Outstanding = append(r.Outstanding, o)
+	}
+	if m.stopping != nil {
+		r.Outstanding = append(r.Outstanding, Outstanding{Kind: "component", Name: m.stopping.name, Started: true, Age: now.Sub(m.stoppingAt)})
+	}
+	m.mu.Unlock()
+
+	if m.stacks {
+		buf := make([]byte, 1<<20)
+		r.Goroutines = string(buf[:runtime.Stack(buf, true)])
+	}
+	return r
+}
+
+func displayName(name string) string {
+	if name == "" {
+		return "(unnamed)"
+	}
+	return name
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
@@ -2,6 +2,8 @@ package event
 
 import (
 	"context"
+	"fmt"
+	"runtime/debug"
 	"sync"
 )
 
@@ -9,48 +11,306 @@ type Event interface {
 }
 
 type listener[T Event] struct {
-	once bool
-	ctx  context.Context
-	fn   func(T)
+	once    bool
+	ctx     context.Context
+	fn      func(T) error
+	stopCtx func() bool
+	// listener 被移除后调用
+	onDetach func()
+
+	// Queued 模式下的事件队列, 由单个 worker 顺序处理
+	mu     sync.Mutex // guards queue sends and closed
+	queue  chan delivery[T]
+	closed bool
+	// detach 时先关闭, 使阻塞在队列上的 enqueue 放弃发送并释放 mu
+	closing     chan struct{}
+	closingOnce sync.Once
+}
+
+type delivery[T Event] struct {
+	event T
+	wg    *sync.WaitGroup
+}
+
+func (d delivery[T]) done() {
+	if d.wg != nil {
+		d.wg.Done()
+	}
 }
 
 type Emitter[T Event] struct {
-	listeners []listener[T]
+	listeners []*listener[T]
 	mu        sync.Mutex // guards
+	opts      options
+
+	// 以下字段由 mu 保护
+	seq      uint64
+	retained *ring[T]
+	log      *eventLog
 }
 
-func NewEmitter[T Event]() *Emitter[T] {
-	return &Emitter[T]{
+func NewEmitter[T Event](opts ...Option) *Emitter[T] {
+	e := &Emitter[T]{
 		listeners: nil,
 		mu:        sync.Mutex{},
+		opts:      defaultOptions,
+	}
+	for _, opt := range opts {
+		opt(&e.opts)
 	}
+	if e.opts.retainMax > 0 || e.opts.retainAge > 0 {
+		e.retained = &ring[T]{max: e.opts.retainMax}
+	}
+	return e
 }
 
-func Listen[T Event](ctx context.Context, once bool, e *Emitter[T], fn func(T)) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	e.listeners = append(e.listeners, listener[T]{
+// 取消订阅的句柄
+type Subscription struct {
+	unsubscribe func()
+	once        sync.Once
+}
+
+// Unsubscribe 移除 listener, 之后不再收到事件, 可以重复调用
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(s.unsubscribe)
+}
+
+// listener panic 时报告给 error handler 的错误
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("event listener panic: %v", e.Value)
+}
+
+func Listen[T Event](ctx context.Context, once bool, e *Emitter[T], fn func(T)) *Subscription {
+	return ListenE(ctx, once, e, func(event T) error {
+		fn(event)
+		return nil
+	})
+}
+
+// ListenE 注册返回错误的 listener, 错误交给 Emitter 的 error handler. ctx 结束时立即移除 listener
+func ListenE[T Event](ctx context.Context, once bool, e *Emitter[T], fn func(T) error) *Subscription {
+	return e.listen(&listener[T]{
 		once: once,
 		ctx:  ctx,
 		fn:   fn,
-	})
+	}, nil)
 }
 
-func Emit[T Event](e *Emitter[T], event T) {
+// 注册 listener, locked 在持有 e.mu 时调用
+func (e *Emitter[T]) listen(l *listener[T], locked func()) *Subscription {
+	ctx := l.ctx
+	if e.opts.mode == Queued {
+		l.queue = make(chan delivery[T], queueSize(e.opts.queueSize, e.opts.overflow))
+		l.closing = make(chan struct{})
+		go l.work(e.opts.errorHandler)
+	}
+	sub := &Subscription{unsubscribe: func() {
+		if e.remove(l) {
+			l.detach()
+		}
+	}}
+	e.mu.Lock()
+	if ctx != nil {
+		// 回调需要获取 e.mu, 在加入 listeners 之后才会执行
+		l.stopCtx = context.AfterFunc(ctx, sub.Unsubscribe)
+	}
+	e.listeners = append(e.listeners, l)
+	if locked != nil {
+		locked()
+	}
+	e.mu.Unlock()
+	return sub
+}
+
+func (e *Emitter[T]) remove(l *listener[T]) bool {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	for i, item := range e.listeners {
+		if item == l {
+			e.listeners = append(e.listeners[:i:i], e.listeners[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Emit 按 Emitter 的投递模式把事件交给所有 listener
+func Emit[T Event](e *Emitter[T], event T) {
+	e.emit(event, nil)
+}
+
+// EmitAndWait 同 Emit, 并等待所有 listener 处理完该事件. Queued 模式下被丢弃的事件不会等待
+func EmitAndWait[T Event](e *Emitter[T], event T) {
+	var wg sync.WaitGroup
+	e.emit(event, &wg)
+	wg.Wait()
+}
+
+func (e *Emitter[T]) emit(event T, wg *sync.WaitGroup) {
+	var targets, removed []*listener[T]
+	e.mu.Lock()
 	list := e.listeners
 	for i := 0; i < len(list); {
 		l := list[i]
 		var expire = l.ctx != nil && l.ctx.Err() != nil
 		if !expire {
-			go l.fn(event)
+			targets = append(targets, l)
 		}
 		if expire || l.once {
+			removed = append(removed, l)
 			list = append(list[:i], list[i+1:]...)
 		} else {
 			i++
 		}
 	}
 	e.listeners = list
+	rec, log := e.record(event)
+	e.mu.Unlock()
+
+	// 在锁外写日志, 按序号顺序写入
+	if log != nil {
+		if err := writeLog(log, rec); err != nil {
+			e.opts.errorHandler(err)
+		}
+	}
+
+	// 在锁外投递, listener 中可以再次 Emit
+	if wg != nil {
+		wg.Add(len(targets))
+	}
+	for _, l := range targets {
+		e.deliver(l, delivery[T]{event: event, wg: wg})
+	}
+	for _, l := range removed {
+		l.detach()
+	}
+}
+
+func (e *Emitter[T]) deliver(l *listener[T], d delivery[T]) {
+	switch e.opts.mode {
+	case Sync:
+		defer d.done()
+		l.call(d.event, e.opts.errorHandler)
+	case Queued:
+		l.enqueue(d, e.opts.overflow)
+	default:
+		go func() {
+			defer d.done()
+			l.call(d.event, e.opts.errorHandler)
+		}()
+	}
+}
+
+func (l *listener[T]) enqueue(d delivery[T], policy OverflowPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		d.done()
+		return
+	}
+	for _, dropped := range offer(l.queue, d, policy, l.closing) {
+		dropped.done()
+	}
+}
+
+// 按 policy 把 v 放入 ch, 返回被丢弃的元素(可能包括 v). Block 时 done 关闭后放弃发送.
+// 同一个 ch 需要调用方保证只有一个发送者
+func offer[V any](ch chan V, v V, policy OverflowPolicy, done <-chan struct{}) (dropped []V) {
+	switch policy {
+	case Drop:
+		select {
+		case ch <- v:
+		default:
+			dropped = append(dropped, v)
+		}
+		return
+	case Coalesce:
+		// 每次都丢弃所有未处理的值, 队列中最多只有最新的一个
+		for {
+			select {
+			case old := <-ch:
+				dropped = append(dropped, old)
+				continue
+			default:
+			}
+			select {
+			case ch <- v:
+				return
+			default:
+			}
+		}
+	case DropOldest:
+		for {
+			select {
+			case ch <- v:
+				return
+			default:
+			}
+			select {
+			case old := <-ch:
+				dropped = append(dropped, old)
+			default:
+			}
+		}
+	}
+	select {
+	case ch <- v:
+	case <-done:
+		dropped = append(dropped, v)
+	}
+	return
+}
+
+// 调用 listener, 返回的错误和 panic 交给 errorHandler
+func (l *listener[T]) call(event T, errorHandler func(err error)) {
+	defer func() {
+		if p := recover(); p != nil {
+			errorHandler(&PanicError{Value: p, Stack: debug.Stack()})
+		}
+	}()
+	if err := l.fn(event); err != nil {
+		errorHandler(err)
+	}
+}
+
+// listener 被移除后释放 ctx 的监听并关闭队列, worker 处理完已入队的事件后退出
+func (l *listener[T]) detach() {
+	if l.stopCtx != nil {
+		l.stopCtx()
+	}
+	if l.onDetach != nil {
+		defer l.onDetach()
+	}
+	if l.queue == nil {
+		return
+	}
+	l.closingOnce.Do(func() {
+		close(l.closing)
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+}
+
+func (l *listener[T]) work(errorHandler func(err error)) {
+	for d := range l.queue {
+		l.call(d.event, errorHandler)
+		d.done()
+	}
+}
+
+// 非 Block 的策略需要有缓冲的队列
+func queueSize(size int, policy OverflowPolicy) int {
+	if policy != Block && size < 1 {
+		return 1
+	}
+	return size
 }
@@ -0,0 +1,159 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueuedUnsubscribeUnblocksEmit(t *testing.T) {
+	e := NewEmitter[int](WithMode(Queued), WithQueueSize(1), WithOverflow(Block))
+	started := make(chan int, 3)
+	release := make(chan struct{})
+	sub := Listen(context.Background(), false, e, func(n int) {
+		started <- n
+		<-release
+	})
+	defer close(release)
+
+	Emit(e, 1)
+	assert.Equal(t, 1, <-started)
+	Emit(e, 2) // 占满队列
+
+	emitted := make(chan struct{})
+	go func() {
+		Emit(e, 3) // 队列已满, 阻塞
+		close(emitted)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// 取消订阅不会被阻塞中的 Emit 卡住, 并让其返回
+	unsubscribed := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(unsubscribed)
+	}()
+	for _, ch := range []chan struct{}{unsubscribed, emitted} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("blocked")
+		}
+	}
+}
+
+func TestSyncOrder(t *testing.T) {
+	e := NewEmitter[int](WithMode(Sync))
+	var got []string
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		Listen(context.Background(), false, e, func(n int) {
+			got = append(got, fmt.Sprint(name, n))
+		})
+	}
+	Emit(e, 1)
+	Emit(e, 2)
+	// Emit 返回时已按注册顺序调用完所有 listener
+	assert.Equal(t, []string{"a1", "b1", "c1", "a2", "b2", "c2"}, got)
+}
+
+func TestQueuedOrder(t *testing.T) {
+	e := NewEmitter[int](WithMode(Queued), WithQueueSize(4))
+	var got []int
+	Listen(context.Background(), false, e, func(n int) {
+		got = append(got, n)
+	})
+	for i := 0; i < 99; i++ {
+		Emit(e, i)
+	}
+	// 同一 listener 按顺序处理, 等待最后一个事件即等待之前所有事件
+	EmitAndWait(e, 99)
+	if assert.Len(t, got, 100) {
+		for i, n := range got {
+			assert.Equal(t, i, n)
+		}
+	}
+}
+
+func TestQueuedOverflow(t *testing.T) {
+	cases := []struct {
+		policy OverflowPolicy
+		want   []int
+	}{
+		{Drop, []int{1, 2, 5}},
+		{DropOldest, []int{1, 4, 5}},
+	}
+	for _, c := range cases {
+		e := NewEmitter[int](WithMode(Queued), WithQueueSize(1), WithOverflow(c.policy))
+		var mu sync.Mutex
+		var got []int
+		started := make(chan struct{}, 1)
+		release := make(chan struct{})
+		Listen(context.Background(), false, e, func(n int) {
+			if n == 1 {
+				started <- struct{}{}
+				<-release
+			}
+			mu.Lock()
+			got = append(got, n)
+			mu.Unlock()
+		})
+
+		Emit(e, 1)
+		<-started
+		// worker 阻塞在 1, 队列只能容纳一个事件
+		Emit(e, 2)
+		Emit(e, 3)
+		Emit(e, 4)
+		close(release)
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(got) == 2
+		}, time.Second, time.Millisecond, "policy %d", c.policy)
+
+		EmitAndWait(e, 5)
+		mu.Lock()
+		assert.Equal(t, c.want, got, "policy %d", c.policy)
+		mu.Unlock()
+	}
+}
+
+func TestEmitAndWait(t *testing.T) {
+	for _, mode := range []DeliveryMode{Async, Sync, Queued} {
+		e := NewEmitter[int](WithMode(mode))
+		var handled int32
+		for i := 0; i < 3; i++ {
+			Listen(context.Background(), false, e, func(n int) {
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&handled, 1)
+			})
+		}
+		// 等待所有 listener 处理完该事件
+		EmitAndWait(e, 1)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&handled), "mode %d", mode)
+	}
+
+	// listener 返回的错误和 panic 交给 errorHandler, 不影响等待
+	var errs []error
+	e := NewEmitter[int](WithMode(Sync), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	ListenE(context.Background(), false, e, func(n int) error {
+		return errors.New("failed")
+	})
+	Listen(context.Background(), false, e, func(n int) {
+		panic("boom")
+	})
+	EmitAndWait(e, 1)
+	if assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "failed")
+		assert.IsType(t, &PanicError{}, errs[1])
+	}
+}
@@ -0,0 +1,103 @@
+package event
+
+import (
+	"log"
+	"time"
+)
+
+// 事件投递给 listener 的方式
+type DeliveryMode int
+
+const (
+	// 每个事件对每个 listener 启动一个 goroutine, 不保证顺序
+	Async DeliveryMode = iota
+	// 在 Emit 中按注册顺序同步调用 listener
+	Sync
+	// 每个 listener 一个有界队列和一个 worker, 按事件顺序异步处理
+	Queued
+)
+
+// Queued 模式下队列已满时的处理方式
+type OverflowPolicy int
+
+const (
+	// Emit 阻塞直到队列有空位
+	Block OverflowPolicy = iota
+	// 丢弃该事件
+	Drop
+	// 丢弃队列中最早的事件
+	DropOldest
+	// 丢弃队列中所有未处理的事件, 只保留最新的
+	Coalesce
+
+	DropNewest = Drop
+)
+
+const defaultQueueSize = 64
+
+type options struct {
+	mode      DeliveryMode
+	queueSize int
+	overflow  OverflowPolicy
+
+	errorHandler func(err error)
+
+	retainMax int
+	retainAge time.Duration
+
+	logSync bool
+}
+
+var defaultOptions = options{
+	mode:      Async,
+	queueSize: defaultQueueSize,
+	overflow:  Block,
+
+	errorHandler: func(err error) {
+		log.Println("event listener error:", err)
+	},
+}
+
+type Option func(o *options)
+
+func WithMode(mode DeliveryMode) Option {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// Queued 模式下每个 listener 的队列长度, 默认 64
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		o.queueSize = size
+	}
+}
+
+// Queued 模式下队列已满时的处理方式, 默认 Block
+func WithOverflow(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow = policy
+	}
+}
+
+// listener 返回的错误和 panic(*PanicError) 的处理函数, 默认打印日志
+func WithErrorHandler(fn func(err error)) Option {
+	return func(o *options) {
+		o.errorHandler = fn
+	}
+}
+
+// 保留最近的 max 个事件或 maxAge 内的事件, 供 ListenFrom 重放, 为 0 表示不限制. 默认不保留
+func WithRetention(max int, maxAge time.Duration) Option {
+	return func(o *options) {
+		o.retainMax = max
+		o.retainAge = maxAge
+	}
+}
+
+// OpenEmitter 的日志每次写入后调用 fsync. 默认不调用, 进程崩溃不会丢失已写入的事件, 但系统崩溃可能丢失最近的事件
+func WithLogSync(enabled bool) Option {
+	return func(o *options) {
+		o.logSync = enabled
+	}
+}
@@ -0,0 +1,294 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// 保留的事件, Seq 从 1 开始递增
+type Record[T Event] struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Event T         `json:"event"`
+}
+
+// 环形缓冲区, max 为 0 时按需增长
+type ring[T Event] struct {
+	buf  []Record[T]
+	head int
+	size int
+	max  int
+}
+
+func (r *ring[T]) push(rec Record[T]) {
+	if r.max > 0 && r.size == r.max {
+		r.buf[r.head] = rec
+		r.head = (r.head + 1) % len(r.buf)
+		return
+	}
+	if r.size == len(r.buf) {
+		n := 2 * len(r.buf)
+		if n == 0 {
+			n = 16
+		}
+		if r.max > 0 && n > r.max {
+			n = r.max
+		}
+		buf := make([]Record[T], n)
+		for i := 0; i < r.size; i++ {
+			buf[i] = r.at(i)
+		}
+		r.buf, r.head = buf, 0
+	}
+	r.buf[(r.head+r.size)%len(r.buf)] = rec
+	r.size++
+}
+
+func (r *ring[T]) at(i int) Record[T] {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+// 丢弃 before 之前的事件
+func (r *ring[T]) trim(before time.Time) {
+	for r.size > 0 && r.at(0).Time.Before(before) {
+		r.buf[r.head] = Record[T]{}
+		r.head = (r.head + 1) % len(r.buf)
+		r.size--
+	}
+}
+
+// 序号不小于 from 的事件
+func (r *ring[T]) since(from uint64) []Record[T] {
+	var list []Record[T]
+	for i := 0; i < r.size; i++ {
+		if rec := r.at(i); rec.Seq >= from {
+			list = append(list, rec)
+		}
+	}
+	return list
+}
+
+// 为事件分配序号并写入保留缓冲区, 返回需要写入的日志文件. 需持有 e.mu
+func (e *Emitter[T]) record(event T) (Record[T], *eventLog) {
+	e.seq++
+	rec := Record[T]{Seq: e.seq, Time: time.Now(), Event: event}
+	if e.retained != nil {
+		e.retained.push(rec)
+		e.trimRetained()
+	}
+	return rec, e.log
+}
+
+// 追加写入的日志文件. 编码在 Emitter 的锁外进行, 写入按序号顺序
+type eventLog struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	f    *os.File
+	next uint64 // 下一个要写入的序号
+	sync bool
+}
+
+func newEventLog(f *os.File, next uint64, fsync bool) *eventLog {
+	l := &eventLog{f: f, next: next, sync: fsync}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// 写入 rec, 等待序号更小的记录先写入. 每个分配了序号的记录都必须调用一次, 否则后续写入会一直等待
+func writeLog[T Event](l *eventLog, rec Record[T]) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		err = errors.Wrap(err, "marshal event error")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.next != rec.Seq {
+		l.cond.Wait()
+	}
+	l.next++
+	l.cond.Broadcast()
+	if err != nil || l.f == nil {
+		return err
+	}
+	if _, err = l.f.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "write event log error")
+	}
+	if l.sync {
+		if err = l.f.Sync(); err != nil {
+			return errors.Wrap(err, "sync event log error")
+		}
+	}
+	return nil
+}
+
+// 等待序号不大于 last 的记录写入后关闭文件
+func (l *eventLog) close(last uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.next <= last {
+		l.cond.Wait()
+	}
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+func (e *Emitter[T]) trimRetained() {
+	if e.opts.retainAge > 0 {
+		e.retained.trim(time.Now().Add(-e.opts.retainAge))
+	}
+}
+
+// LastSeq 最后一个事件的序号, 没有事件时为 0
+func (e *Emitter[T]) LastSeq() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.seq
+}
+
+// Retained 仍保留的序号不小于 from 的事件
+func (e *Emitter[T]) Retained(from uint64) []Record[T] {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.retained == nil {
+		return nil
+	}
+	e.trimRetained()
+	return e.retained.since(from)
+}
+
+// ListenFrom 先重放仍保留的序号不小于 from 的事件, 然后接收新事件, 两者之间没有遗漏或重复.
+// 重放在调用方 goroutine 中进行, 期间新事件的投递会等待重放结束.
+// first 为收到的第一个事件的序号, 大于 from 时表示 [from, first) 之间的事件已不再保留
+func ListenFrom[T Event](ctx context.Context, e *Emitter[T], from uint64, fn func(T)) (sub *Subscription, first uint64) {
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+
+	var replay []Record[T]
+	sub = e.listen(&listener[T]{
+		ctx: ctx,
+		fn: func(event T) error {
+			mu.Lock()
+			defer mu.Unlock()
+			fn(event)
+			return nil
+		},
+	}, func() {
+		if e.retained != nil {
+			e.trimRetained()
+			replay = e.retained.since(from)
+		}
+		first = e.seq + 1
+		if len(replay) > 0 {
+			first = replay[0].Seq
+		}
+	})
+
+	for _, rec := range replay {
+		if ctx != nil && ctx.Err() != nil {
+			break
+		}
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					e.opts.errorHandler(&PanicError{Value: p, Stack: debug.Stack()})
+				}
+			}()
+			fn(rec.Event)
+		}()
+	}
+	return sub, first
+}
+
+// OpenEmitter 创建以 path 为追加日志(JSON lines)的 Emitter, 文件中已有的事件按保留设置载入, 序号从最后一个事件继续.
+// 不再使用时需调用 Close
+func OpenEmitter[T Event](path string, opts ...Option) (*Emitter[T], error) {
+	records, size, err := readLog[T](path)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open event log error")
+	}
+	// 截掉写入中断的最后一行, 避免与新记录连在一起
+	if err = f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "truncate event log error")
+	}
+
+	e := NewEmitter[T](opts...)
+	for _, rec := range records {
+		e.seq = rec.Seq
+		if e.retained != nil {
+			e.retained.push(rec)
+		}
+	}
+	if e.retained != nil {
+		e.trimRetained()
+	}
+	e.log = newEventLog(f, e.seq+1, e.opts.logSync)
+	return e, nil
+}
+
+// Close 等待已分配序号的事件写入后关闭日志文件, 之后的事件不再写入. 没有日志文件时什么都不做, 可以重复调用
+func (e *Emitter[T]) Close() error {
+	e.mu.Lock()
+	l, last := e.log, e.seq
+	e.log = nil
+	e.mu.Unlock()
+	if l == nil {
+		return nil
+	}
+	return l.close(last)
+}
+
+// ReadLog 读取 OpenEmitter 写入的日志, 忽略末尾未写完整的一行
+func ReadLog[T Event](path string) ([]Record[T], error) {
+	records, _, err := readLog[T](path)
+	return records, err
+}
+
+// 返回日志中的事件和完整的行的总长度
+func readLog[T Event](path string) (records []Record[T], size int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "open event log error")
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 没有换行的最后一行是写入中断的记录
+			return records, size, nil
+		}
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "read event log error")
+		}
+		size += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record[T]
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, 0, errors.Wrap(err, "decode event log error")
+		}
+		records = append(records, rec)
+	}
+}
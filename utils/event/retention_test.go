@@ -0,0 +1,117 @@
+package event
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionEviction(t *testing.T) {
+	e := NewEmitter[int](WithMode(Sync), WithRetention(3, 0))
+	for i := 1; i <= 5; i++ {
+		Emit(e, i*10)
+	}
+	var seqs []uint64
+	for _, rec := range e.Retained(0) {
+		seqs = append(seqs, rec.Seq)
+	}
+	assert.Equal(t, []uint64{3, 4, 5}, seqs)
+	assert.Equal(t, uint64(5), e.LastSeq())
+
+	// 已被淘汰的序号通过 first 报告缺口
+	var got []int
+	sub, first := ListenFrom(context.Background(), e, 1, func(n int) { got = append(got, n) })
+	defer sub.Unsubscribe()
+	assert.Equal(t, uint64(3), first)
+	assert.Equal(t, []int{30, 40, 50}, got)
+
+	_, first = ListenFrom(context.Background(), e, 6, func(int) {})
+	assert.Equal(t, uint64(6), first)
+}
+
+func TestListenFromConcurrent(t *testing.T) {
+	const n = 2000
+	e := NewEmitter[int](WithMode(Sync), WithRetention(n, 0))
+	half := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= n; i++ {
+			Emit(e, i)
+			if i == n/2 {
+				close(half)
+			}
+		}
+	}()
+
+	// 在发送过程中订阅, 重放和新事件之间没有遗漏或重复
+	<-half
+	var mu sync.Mutex
+	var got []int
+	sub, first := ListenFrom(context.Background(), e, 1, func(i int) {
+		mu.Lock()
+		got = append(got, i)
+		mu.Unlock()
+	})
+	defer sub.Unsubscribe()
+	wg.Wait()
+
+	assert.Equal(t, uint64(1), first)
+	require.Len(t, got, n)
+	for i, v := range got {
+		assert.Equal(t, i+1, v)
+	}
+}
+
+func TestEmitterLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	e, err := OpenEmitter[string](path, WithMode(Sync), WithLogSync(true))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				Emit(e, "x")
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, e.Close())
+	require.NoError(t, e.Close())
+
+	// 日志按序号顺序写入
+	records, err := ReadLog[string](path)
+	require.NoError(t, err)
+	require.Len(t, records, 400)
+	for i, rec := range records {
+		assert.Equal(t, uint64(i+1), rec.Seq)
+	}
+
+	// 模拟写入中断的最后一行
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":401,"ev`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	e, err = OpenEmitter[string](path, WithMode(Sync), WithRetention(2, 0))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(400), e.LastSeq())
+	assert.Len(t, e.Retained(0), 2)
+	Emit(e, "y")
+	require.NoError(t, e.Close())
+
+	records, err = ReadLog[string](path)
+	require.NoError(t, err)
+	require.Len(t, records, 401)
+	assert.Equal(t, Record[string]{Seq: 401, Time: records[400].Time, Event: "y"}, records[400])
+}
@@ -0,0 +1,66 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// 以 channel 接收事件的订阅
+type ChanSubscription[T Event] struct {
+	// ctx 结束或取消订阅后关闭
+	C <-chan T
+
+	sub     *Subscription
+	dropped atomic.Uint64
+}
+
+// Dropped 因缓冲区已满(或 Block 时订阅已结束)被丢弃的事件数
+func (s *ChanSubscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *ChanSubscription[T]) Unsubscribe() {
+	s.sub.Unsubscribe()
+}
+
+// Subscribe 返回接收事件的 channel, ctx 结束时关闭. 缓冲区满时按 policy 处理:
+// Block 阻塞 listener(Sync 模式下即 Emit), DropNewest 丢弃新事件, DropOldest 丢弃最早的事件, Coalesce 只保留最新的事件
+func Subscribe[T Event](ctx context.Context, e *Emitter[T], bufSize int, policy OverflowPolicy) <-chan T {
+	return SubscribeChan(ctx, e, bufSize, policy).C
+}
+
+// SubscribeChan 同 Subscribe, 返回的订阅可以查询丢弃的事件数
+func SubscribeChan[T Event](ctx context.Context, e *Emitter[T], bufSize int, policy OverflowPolicy) *ChanSubscription[T] {
+	ch := make(chan T, queueSize(bufSize, policy))
+	s := &ChanSubscription[T]{C: ch}
+
+	// 发送和关闭都在 mu 下进行
+	var mu sync.Mutex
+	var closed bool
+	done := make(chan struct{})
+	s.sub = e.listen(&listener[T]{
+		ctx: ctx,
+		fn: func(event T) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if closed {
+				s.dropped.Add(1)
+				return nil
+			}
+			if dropped := offer(ch, event, policy, done); len(dropped) > 0 {
+				s.dropped.Add(uint64(len(dropped)))
+			}
+			return nil
+		},
+		onDetach: func() {
+			// 先通知阻塞中的发送者放弃, 再获取 mu
+			close(done)
+			mu.Lock()
+			closed = true
+			close(ch)
+			mu.Unlock()
+		},
+	}, nil)
+	return s
+}
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeOverflow(t *testing.T) {
+	drain := func(ch <-chan int) []int {
+		var got []int
+		for {
+			select {
+			case n := <-ch:
+				got = append(got, n)
+			default:
+				return got
+			}
+		}
+	}
+	cases := []struct {
+		policy  OverflowPolicy
+		want    []int
+		dropped uint64
+	}{
+		{DropNewest, []int{1, 2}, 2},
+		{DropOldest, []int{3, 4}, 2},
+		// 缓冲区未满时也只保留最新的事件
+		{Coalesce, []int{4}, 3},
+	}
+	for _, c := range cases {
+		e := NewEmitter[int](WithMode(Sync))
+		ctx, cancel := context.WithCancel(context.Background())
+		sub := SubscribeChan(ctx, e, 2, c.policy)
+		for i := 1; i <= 4; i++ {
+			Emit(e, i)
+		}
+		assert.Equal(t, c.want, drain(sub.C), "policy %d", c.policy)
+		assert.Equal(t, c.dropped, sub.Dropped(), "policy %d", c.policy)
+		cancel()
+	}
+
+	e := NewEmitter[int](WithMode(Sync))
+	sub := SubscribeChan(context.Background(), e, 8, Coalesce)
+	Emit(e, 1)
+	Emit(e, 2)
+	assert.Equal(t, []int{2}, drain(sub.C))
+	sub.Unsubscribe()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
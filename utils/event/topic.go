@@ -0,0 +1,89 @@
+package event
+
+import (
+	"context"
+	"strings"
+)
+
+const topicSep = "."
+
+// ListenWhere 只接收 pred 返回 true 的事件
+func ListenWhere[T Event](ctx context.Context, e *Emitter[T], pred func(T) bool, fn func(T)) *Subscription {
+	return ListenE(ctx, false, e, func(event T) error {
+		if pred(event) {
+			fn(event)
+		}
+		return nil
+	})
+}
+
+// Hub 上发布的事件
+type Message struct {
+	Topic   string
+	Payload interface{}
+}
+
+// Hub 按 topic 路由事件, 一个 Hub 可以承载多种 payload 类型的事件
+type Hub struct {
+	e *Emitter[Message]
+}
+
+// NewHub 的选项同 NewEmitter
+func NewHub(opts ...Option) *Hub {
+	return &Hub{e: NewEmitter[Message](opts...)}
+}
+
+func (h *Hub) Emitter() *Emitter[Message] {
+	return h.e
+}
+
+func (h *Hub) Publish(topic string, payload interface{}) {
+	Emit(h.e, Message{Topic: topic, Payload: payload})
+}
+
+func (h *Hub) PublishAndWait(topic string, payload interface{}) {
+	EmitAndWait(h.e, Message{Topic: topic, Payload: payload})
+}
+
+// ListenTopic 接收 topic 匹配 pattern 且 payload 类型为 P 的事件.
+// pattern 以 . 分隔, * 匹配一段, ** 匹配任意多段(包括零段), 如 order.* 匹配 order.created, order.** 还匹配 order.item.added
+func ListenTopic[P any](ctx context.Context, h *Hub, pattern string, fn func(topic string, payload P)) *Subscription {
+	segments := strings.Split(pattern, topicSep)
+	return ListenWhere(ctx, h.e, func(msg Message) bool {
+		if _, ok := msg.Payload.(P); !ok {
+			return false
+		}
+		return matchTopic(segments, strings.Split(msg.Topic, topicSep))
+	}, func(msg Message) {
+		fn(msg.Topic, msg.Payload.(P))
+	})
+}
+
+// MatchTopic 判断 topic 是否匹配 pattern, 规则同 ListenTopic
+func MatchTopic(pattern, topic string) bool {
+	return matchTopic(strings.Split(pattern, topicSep), strings.Split(topic, topicSep))
+}
+
+func matchTopic(pattern, topic []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "**":
+			for i := 0; i <= len(topic); i++ {
+				if matchTopic(pattern[1:], topic[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(topic) == 0 {
+				return false
+			}
+		default:
+			if len(topic) == 0 || pattern[0] != topic[0] {
+				return false
+			}
+		}
+		pattern, topic = pattern[1:], topic[1:]
+	}
+	return len(topic) == 0
+}
@@ -0,0 +1,82 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.paid", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order", false},
+		{"order.*", "order.item.added", false},
+		{"*.created", "order.created", true},
+		{"order.*.added", "order.item.added", true},
+		{"order.*.added", "order.added", false},
+		// ** 在末尾
+		{"order.**", "order.item.added", true},
+		{"order.**", "order", true},
+		{"order.**", "user.created", false},
+		// ** 在开头
+		{"**.added", "order.item.added", true},
+		{"**.added", "added", true},
+		{"**.added", "order.item.removed", false},
+		// ** 在中间, 可以匹配零段
+		{"order.**.added", "order.added", true},
+		{"order.**.added", "order.item.sku.added", true},
+		{"order.**.added", "order.item.removed", false},
+		{"**", "anything.at.all", true},
+		{"order.**.*", "order", false},
+		{"order.**.*", "order.created", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, MatchTopic(c.pattern, c.topic), "%s ~ %s", c.pattern, c.topic)
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub(WithMode(Sync))
+	var ids []int
+	var names []string
+	ListenTopic(context.Background(), h, "order.*", func(topic string, id int) {
+		ids = append(ids, id)
+	})
+	ListenTopic(context.Background(), h, "order.**", func(topic string, name string) {
+		names = append(names, topic+":"+name)
+	})
+
+	// payload 类型不匹配的事件被忽略
+	h.Publish("order.created", 1)
+	h.Publish("order.created", "first")
+	h.Publish("order.item.added", 2)
+	h.Publish("order.item.added", "sku")
+	h.Publish("user.created", 3)
+	h.PublishAndWait("order.paid", 4)
+
+	assert.Equal(t, []int{1, 4}, ids)
+	assert.Equal(t, []string{"order.created:first", "order.item.added:sku"}, names)
+}
+
+func TestListenWhere(t *testing.T) {
+	e := NewEmitter[int](WithMode(Sync))
+	var got []int
+	sub := ListenWhere(context.Background(), e, func(n int) bool {
+		return n%2 == 0
+	}, func(n int) {
+		got = append(got, n)
+	})
+	for i := 1; i <= 5; i++ {
+		Emit(e, i)
+	}
+	sub.Unsubscribe()
+	Emit(e, 6)
+	assert.Equal(t, []int{2, 4}, got)
+}
@@ -0,0 +1,252 @@
+package http_server_util
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+const defaultMaxMemory = 32 << 20
+
+// 结构体注入器, 一般为 *injector.Inject
+type Injector interface {
+	StructCtx(ctx context.Context, current interface{}) error
+}
+
+// 请求绑定失败或注入时字段校验失败, 响应 400; 被包装的错误带有 4xx 状态码时(如 ErrNotFound 对应的 404)使用该状态码
+type BindError struct {
+	Err error
+}
+
+func (e *BindError) Error() string {
+	return "bad request: " + e.Err.Error()
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BindError) HttpStatusCode() int {
+	if code, ok := clientErrorCode(e.Err); ok {
+		return code
+	}
+	return http.StatusBadRequest
+}
+
+// 错误带有 4xx 状态码时返回该状态码, 如 injector.FieldErrors
+func clientErrorCode(err error) (int, bool) {
+	var codeAble interface {
+		HttpStatusCode() int
+	}
+	if !errors.As(err, &codeAble) {
+		return 0, false
+	}
+	code := codeAble.HttpStatusCode()
+	return code, code >= 400 && code < 500
+}
+
+var typTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// 绑定的来源 tag, 按顺序覆盖 json body 中的值
+var bindSources = []struct {
+	tag    string
+	values func(r *http.Request, name string) []string
+}{
+	{"path", func(r *http.Request, name string) []string {
+		if v := r.PathValue(name); v != "" {
+			return []string{v}
+		}
+		return nil
+	}},
+	{"query", func(r *http.Request, name string) []string {
+		return r.URL.Query()[name]
+	}},
+	{"header", func(r *http.Request, name string) []string {
+		return r.Header.Values(name)
+	}},
+	{"cookie", func(r *http.Request, name string) []string {
+		if c, err := r.Cookie(name); err == nil {
+			return []string{c.Value}
+		}
+		return nil
+	}},
+	{"form", func(r *http.Request, name string) []string {
+		return r.Form[name]
+	}},
+}
+
+// Bind 把请求填充到结构体指针 v: json body 按 json tag 解码, 然后按字段的 path, query, header, cookie, form tag 取值
+func Bind(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind target must be a non-nil struct pointer")
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "application/json":
+			if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+				return errors.Wrap(err, "decode json body error")
+			}
+		case "multipart/form-data":
+			if err := r.ParseMultipartForm(defaultMaxMemory); err != nil {
+				return errors.Wrap(err, "parse multipart form error")
+			}
+		}
+	}
+	if r.Form == nil {
+		if err := r.ParseForm(); err != nil {
+			return errors.Wrap(err, "parse form error")
+		}
+	}
+
+	_, err := bindStruct(r, rv.Elem())
+	return err
+}
+
+// 返回是否有字段被赋值
+func bindStruct(r *http.Request, sv reflect.Value) (bound bool, err error) {
+	typ := sv.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		fld := typ.Field(i)
+		field := sv.Field(i)
+		if fld.Anonymous && fld.Type.Kind() == reflect.Struct {
+			ok, err := bindStruct(r, field)
+			if err != nil {
+				return bound, err
+			}
+			bound = bound || ok
+			continue
+		}
+		if fld.PkgPath != "" {
+			continue
+		}
+		if fld.Anonymous && fld.Type.Kind() == reflect.Ptr && fld.Type.Elem().Kind() == reflect.Struct {
+			// 嵌入的结构体指针为 nil 时, 只在有字段被赋值时创建
+			target := field
+			if field.IsNil() {
+				target = reflect.New(fld.Type.Elem())
+			}
+			ok, err := bindStruct(r, target.Elem())
+			if err != nil {
+				return bound, err
+			}
+			if ok && field.IsNil() {
+				field.Set(target)
+			}
+			bound = bound || ok
+			continue
+		}
+		for _, source := range bindSources {
+			name, ok := fld.Tag.Lookup(source.tag)
+			if !ok || name == "" || name == "-" {
+				continue
+			}
+			values := source.values(r, name)
+			if len(values) == 0 {
+				continue
+			}
+			if err := setField(field, values); err != nil {
+				return bound, errors.Wrapf(err, "bind %s %s to field %s error", source.tag, name, fld.Name)
+			}
+			bound = true
+		}
+	}
+	return bound, nil
+}
+
+// 字符串值转换为字段类型, 切片字段接收所有值, 其余字段取第一个
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 && !reflect.PointerTo(field.Type()).Implements(typTextUnmarshaler) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+func setValue(field reflect.Value, s string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if reflect.PointerTo(field.Type()).Implements(typTextUnmarshaler) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Slice:
+		// []byte
+		field.SetBytes([]byte(s))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return errors.Errorf("[%s] is not a valid %s", s, field.Type())
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return errors.Errorf("[%s] is not a valid %s", s, field.Type())
+		}
+		field.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return errors.Errorf("[%s] is not a valid %s", s, field.Type())
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.Errorf("[%s] is not a valid bool", s)
+		}
+		field.SetBool(b)
+	default:
+		return errors.Errorf("bind not supported for %s", field.Type())
+	}
+	return nil
+}
+
+// HandleBound 绑定请求到 T 并执行注入. 绑定失败和注入的字段错误(带 4xx 状态码, 如 injector.FieldErrors)返回 BindError,
+// 能自行响应的错误由其响应; 其他注入错误(如 tag 定义错误, ctx 取消)原样返回. inj 为 nil 时只绑定
+func HandleBound[T any](inj Injector, fn func(writer http.ResponseWriter, request *http.Request, v *T) error) http.HandlerFunc {
+	return HandleFuncWithError(Bound(inj, fn))
+}
+
+// Bound 同 HandleBound, 返回 ErrHandler 以便用于 Chain 和 Mux
+func Bound[T any](inj Injector, fn func(writer http.ResponseWriter, request *http.Request, v *T) error) ErrHandler {
+	return func(writer http.ResponseWriter, request *http.Request) error {
+		v := new(T)
+		if err := Bind(request, v); err != nil {
+			return &BindError{Err: err}
+		}
+		if inj != nil {
+			if err := inj.StructCtx(request.Context(), v); err != nil {
+				if _, ok := clientErrorCode(err); ok {
+					return &BindError{Err: err}
+				}
+				return err
+			}
+		}
+		return fn(writer, request, v)
+	}
+}
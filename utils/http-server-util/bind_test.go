@@ -0,0 +1,145 @@
+package http_server_util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type Paging struct {
+	Page int `query:"page"`
+}
+
+type Trace struct {
+	TraceID string `header:"X-Trace-Id"`
+}
+
+type bindInput struct {
+	*Paging
+	*Trace
+	Name  string   `json:"name"`
+	ID    int      `path:"id"`
+	Tags  []string `query:"tag"`
+	Token *string  `cookie:"token"`
+	Age   int      `form:"age"`
+}
+
+func TestBind(t *testing.T) {
+	var got *bindInput
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/{id}", func(writer http.ResponseWriter, request *http.Request) {
+		got = new(bindInput)
+		if err := Bind(request, got); err != nil {
+			WriteError(writer, request, &BindError{Err: err})
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/12?page=3&tag=a&tag=b", strings.NewReader(`{"name":"peter"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "token", Value: "secret"})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if !assert.Equal(t, http.StatusOK, rec.Code) {
+		return
+	}
+	assert.Equal(t, "peter", got.Name)
+	assert.Equal(t, 12, got.ID)
+	assert.Equal(t, []string{"a", "b"}, got.Tags)
+	if assert.NotNil(t, got.Token) {
+		assert.Equal(t, "secret", *got.Token)
+	}
+	// 嵌入的结构体指针只在有字段被赋值时创建
+	if assert.NotNil(t, got.Paging) {
+		assert.Equal(t, 3, got.Page)
+	}
+	assert.Nil(t, got.Trace)
+
+	req = httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("age=20"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 20, got.Age)
+
+	req = httptest.NewRequest(http.MethodGet, "/users/abc", nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "bind path id to field ID error")
+}
+
+// 带状态码的注入错误, 类似 injector.FieldErrors 和 injector.TagDefinitionErrors
+type codeError int
+
+func (e codeError) Error() string {
+	return http.StatusText(int(e))
+}
+
+func (e codeError) HttpStatusCode() int {
+	return int(e)
+}
+
+type injectorFunc func(ctx context.Context, current interface{}) error
+
+func (fn injectorFunc) StructCtx(ctx context.Context, current interface{}) error {
+	return fn(ctx, current)
+}
+
+func TestHandleBound(t *testing.T) {
+	var injectErr error
+	inj := injectorFunc(func(ctx context.Context, current interface{}) error {
+		return injectErr
+	})
+	type input struct {
+		Name string `query:"name"`
+	}
+	var called bool
+	fn := func(writer http.ResponseWriter, request *http.Request, v *input) error {
+		called = true
+		_, err := writer.Write([]byte("hello " + v.Name))
+		return err
+	}
+	handler := HandleBound(inj, fn)
+	serve := func(target string) *httptest.ResponseRecorder {
+		called = false
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := serve("/?name=peter")
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "hello peter", rec.Body.String())
+
+	// 请求无法绑定
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{"))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// 字段错误保留 4xx 状态码
+	for _, code := range []int{http.StatusBadRequest, http.StatusNotFound} {
+		injectErr = codeError(code)
+		rec = serve("/")
+		assert.False(t, called)
+		assert.Equal(t, code, rec.Code)
+	}
+
+	// 服务端错误不转为 400
+	injectErr = codeError(http.StatusInternalServerError)
+	rec = serve("/")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	injectErr = errors.Wrap(context.Canceled, "inject")
+	err := Bound(inj, fn)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, errors.Is(err, context.Canceled))
+	var bindErr *BindError
+	assert.False(t, errors.As(err, &bindErr))
+}
@@ -0,0 +1,170 @@
+package http_server_util
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// 能提供机器可读错误码和详情的错误
+type CodedError interface {
+	ErrorCode() string
+	ErrorDetails() interface{}
+}
+
+// 错误响应的内容, 由 ErrorRenderer 渲染
+type ErrorBody struct {
+	Status    int         `json:"status"`
+	Code      string      `json:"code,omitempty"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// 错误响应渲染器, 根据请求的 Accept 选择
+type ErrorRenderer interface {
+	ContentType() string
+	Render(w io.Writer, body *ErrorBody) error
+}
+
+type requestIDKey struct{}
+
+// 在 context 中记录请求 ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// 请求 ID, 优先取 context 中的, 其次取请求头
+func RequestID(request *http.Request) string {
+	if id, ok := request.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return request.Header.Get(RequestIDHeader)
+}
+
+var (
+	renderersMu sync.RWMutex
+	// 第一个为默认渲染器, 客户端未指定 Accept 或接受任意类型时使用
+	errorRenderers = []ErrorRenderer{TextErrorRenderer{}, JsonErrorRenderer{}, HtmlErrorRenderer{}}
+)
+
+// 注册错误渲染器, 同 ContentType 的渲染器会被替换
+func RegisterErrorRenderer(renderer ErrorRenderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	for i, r := range errorRenderers {
+		if r.ContentType() == renderer.ContentType() {
+			errorRenderers[i] = renderer
+			return
+		}
+	}
+	errorRenderers = append(errorRenderers, renderer)
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func negotiateErrorRenderer(accept string) ErrorRenderer {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		for _, renderer := range errorRenderers {
+			if mediaTypeMatch(r.mediaType, renderer.ContentType()) {
+				return renderer
+			}
+		}
+	}
+	return errorRenderers[0]
+}
+
+func mediaTypeMatch(pattern, contentType string) bool {
+	if pattern == "*/*" || pattern == contentType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+type TextErrorRenderer struct{}
+
+func (TextErrorRenderer) ContentType() string {
+	return "text/plain"
+}
+
+func (TextErrorRenderer) Render(w io.Writer, body *ErrorBody) error {
+	msg := body.Message
+	if body.RequestID != "" {
+		msg += "\nrequest id: " + body.RequestID
+	}
+	_, err := io.WriteString(w, msg)
+	return err
+}
+
+type JsonErrorRenderer struct{}
+
+func (JsonErrorRenderer) ContentType() string {
+	return "application/json"
+}
+
+func (JsonErrorRenderer) Render(w io.Writer, body *ErrorBody) error {
+	return json.NewEncoder(w).Encode(body)
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+{{if .Code}}<p>code: {{.Code}}</p>{{end}}
+{{if .RequestID}}<p>request id: {{.RequestID}}</p>{{end}}
+</body>
+</html>
+`))
+
+type HtmlErrorRenderer struct{}
+
+func (HtmlErrorRenderer) ContentType() string {
+	return "text/html"
+}
+
+func (HtmlErrorRenderer) Render(w io.Writer, body *ErrorBody) error {
+	return errorPageTemplate.Execute(w, struct {
+		*ErrorBody
+		StatusText string
+	}{body, http.StatusText(body.Status)})
+}
@@ -1,42 +1,104 @@
 package http_server_util
 
 import (
-	"fmt"
 	"github.com/pkg/errors"
+	"log"
 	"net/http"
+	"runtime/debug"
 )
 
+// handler panic 时返回给客户端的错误, 不暴露 panic 的内容
+var ErrInternal = &StatusError{Code: http.StatusInternalServerError, Message: "internal server error"}
+
+// 带 http 状态码的错误
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+func (e *StatusError) HttpStatusCode() int {
+	return e.Code
+}
+
 func HandleFuncWithError(fn func(writer http.ResponseWriter, request *http.Request) error) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		var err error
 		defer func() {
 			if p := recover(); p != nil {
-				if e, ok := p.(error); ok {
-					err = e
-				} else {
-					err = errors.New(fmt.Sprintf("%#v", p))
-				}
+				err = panicError(request, p)
 			}
 			if err == nil {
 				return
 			}
-			if respAble, ok := err.(interface {
-				WriteHttpResponse(writer http.ResponseWriter, request *http.Request)
-			}); ok {
-				respAble.WriteHttpResponse(writer, request)
-				return
-			}
-
-			var code = 502
-			if codeAble, ok := err.(interface {
-				HttpStatusCode() int
-			}); ok {
-				code = codeAble.HttpStatusCode()
-			}
-			writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			writer.WriteHeader(code)
-			_, _ = writer.Write([]byte(err.Error()))
+			WriteError(writer, request, err)
 		}()
 		err = fn(writer, request)
 	}
 }
+
+// WriteError 响应错误: 错误自身实现了 WriteHttpResponse 时由其响应, 否则根据 Accept 选择 ErrorRenderer 渲染
+func WriteError(writer http.ResponseWriter, request *http.Request, err error) {
+	// 包装的错误(如 BindError)中能自行响应的错误优先
+	var respAble interface {
+		WriteHttpResponse(writer http.ResponseWriter, request *http.Request)
+	}
+	if errors.As(err, &respAble) {
+		respAble.WriteHttpResponse(writer, request)
+		return
+	}
+
+	code := ErrorStatusCode(err)
+	body := &ErrorBody{
+		Status:    code,
+		Message:   err.Error(),
+		RequestID: RequestID(request),
+	}
+	var coded CodedError
+	if errors.As(err, &coded) {
+		body.Code = coded.ErrorCode()
+		body.Details = coded.ErrorDetails()
+	}
+
+	renderer := negotiateErrorRenderer(request.Header.Get("Accept"))
+	writer.Header().Set("Content-Type", renderer.ContentType()+"; charset=utf-8")
+	writer.WriteHeader(code)
+	if rErr := renderer.Render(writer, body); rErr != nil {
+		log.Println("render http error response error:", rErr)
+	}
+}
+
+// 错误对应的 http 状态码, 错误未实现 HttpStatusCode 时为 502
+func ErrorStatusCode(err error) int {
+	var codeAble interface {
+		HttpStatusCode() int
+	}
+	if errors.As(err, &codeAble) {
+		return codeAble.HttpStatusCode()
+	}
+	return 502
+}
+
+// panic 的值是能自行响应或带状态码的错误时按该错误响应; http.ErrAbortHandler 继续 panic 以中断响应;
+// 其余记录 panic 的值和调用栈, 返回不含 panic 内容的 ErrInternal
+func panicError(request *http.Request, p interface{}) error {
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	if err, ok := p.(error); ok {
+		var httpErr interface {
+			HttpStatusCode() int
+		}
+		var respAble interface {
+			WriteHttpResponse(writer http.ResponseWriter, request *http.Request)
+		}
+		if errors.As(err, &httpErr) || errors.As(err, &respAble) {
+			return err
+		}
+	}
+	log.Printf("http handler panic: %s %s: %v\n%s", request.Method, request.URL.Path, p, debug.Stack())
+	return ErrInternal
+}
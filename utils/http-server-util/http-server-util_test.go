@@ -0,0 +1,44 @@
+package http_server_util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlePanic(t *testing.T) {
+	for _, recoverMw := range []bool{false, true} {
+		var panicValue interface{}
+		var h ErrHandler = func(writer http.ResponseWriter, request *http.Request) error {
+			panic(panicValue)
+		}
+		if recoverMw {
+			h = Recover()(h)
+		}
+		serve := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			return rec
+		}
+
+		// panic 的内容不返回给客户端
+		panicValue = errors.New("secret")
+		rec := serve()
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "secret")
+
+		// 带状态码的错误按该错误响应
+		panicValue = errors.Wrap(&StatusError{Code: http.StatusForbidden, Message: "forbidden"}, "check")
+		rec = serve()
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "forbidden")
+
+		panicValue = http.ErrAbortHandler
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			serve()
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package http_server_util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 返回错误的 http handler, 错误由 HandleFuncWithError 响应
+type ErrHandler func(writer http.ResponseWriter, request *http.Request) error
+
+func (h ErrHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	HandleFuncWithError(h)(writer, request)
+}
+
+type Middleware func(next ErrHandler) ErrHandler
+
+var (
+	ErrRequestTimeout = &StatusError{Code: http.StatusGatewayTimeout, Message: "request timeout"}
+	ErrShuttingDown   = &StatusError{Code: http.StatusServiceUnavailable, Message: "server is shutting down"}
+)
+
+// Chain 组合多个中间件, 第一个在最外层
+func Chain(mw ...Middleware) Middleware {
+	return func(next ErrHandler) ErrHandler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		return next
+	}
+}
+
+// Recover 把 panic 转为 ErrInternal, 使外层中间件(如 Logging)能看到该错误
+func Recover() Middleware {
+	return func(next ErrHandler) ErrHandler {
+		return func(writer http.ResponseWriter, request *http.Request) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = panicError(request, p)
+				}
+			}()
+			return next(writer, request)
+		}
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging 记录请求的方法, 路径, 状态码, 耗时和错误, logger 为 nil 时使用 log 包默认 logger
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next ErrHandler) ErrHandler {
+		return func(writer http.ResponseWriter, request *http.Request) error {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: writer}
+			err := next(sw, request)
+
+			status := sw.status
+			if err != nil {
+				status = ErrorStatusCode(err)
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+			line := request.Method + " " + request.URL.RequestURI() + " " + strconv.Itoa(status) + " " + time.Since(start).String()
+			if id := RequestID(request); id != "" {
+				line += " request_id=" + id
+			}
+			if err != nil {
+				line += " error=" + err.Error()
+			}
+			logger.Println(line)
+			return err
+		}
+	}
+}
+
+// AssignRequestID 使用请求头 X-Request-Id 或生成新的请求 ID, 写入 context 和响应头
+func AssignRequestID() Middleware {
+	return func(next ErrHandler) ErrHandler {
+		return func(writer http.ResponseWriter, request *http.Request) error {
+			id := request.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = newRequestID()
+			}
+			writer.Header().Set(RequestIDHeader, id)
+			return next(writer, request.WithContext(WithRequestID(request.Context(), id)))
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Timeout 请求的 context 在超时或 shutdown 结束时取消, handler 因此返回错误时响应 504 或 503.
+// shutdown 一般为 app.Context() 或 Manager.Context(), 为 nil 时不处理退出; d <= 0 时只在 shutdown 结束时取消
+func Timeout(d time.Duration, shutdown context.Context) Middleware {
+	shuttingDown := func() bool {
+		return shutdown != nil && shutdown.Err() != nil
+	}
+	return func(next ErrHandler) ErrHandler {
+		return func(writer http.ResponseWriter, request *http.Request) error {
+			if shuttingDown() {
+				return ErrShuttingDown
+			}
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if d > 0 {
+				ctx, cancel = context.WithTimeout(request.Context(), d)
+			} else {
+				ctx, cancel = context.WithCancel(request.Context())
+			}
+			defer cancel()
+			if shutdown != nil {
+				stop := context.AfterFunc(shutdown, cancel)
+				defer stop()
+			}
+
+			err := next(writer, request.WithContext(ctx))
+			if err != nil && ctx.Err() != nil && request.Context().Err() == nil {
+				if shuttingDown() {
+					return ErrShuttingDown
+				}
+				return ErrRequestTimeout
+			}
+			return err
+		}
+	}
+}
+
+type CORSOptions struct {
+	AllowOrigins     []string // 为空时允许所有来源
+	AllowMethods     []string // 为空时允许 GET, HEAD, POST, PUT, PATCH, DELETE
+	AllowHeaders     []string // 为空时允许预检请求中的所有请求头
+	ExposeHeaders    []string
+	AllowCredentials bool // 需要在 AllowOrigins 中明确列出来源, 不能为空或包含 "*"
+	MaxAge           time.Duration
+}
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// CORS 添加跨域响应头, 并直接响应预检请求. AllowCredentials 时 AllowOrigins 为空或包含 "*" 会 panic,
+// 否则任意来源都能带着用户的 cookie 发起请求
+func CORS(opts CORSOptions) Middleware {
+	if opts.AllowCredentials {
+		if len(opts.AllowOrigins) == 0 {
+			panic("cors AllowCredentials requires explicit AllowOrigins")
+		}
+		for _, o := range opts.AllowOrigins {
+			if o == "*" {
+				panic("cors AllowCredentials can not be used with AllowOrigins \"*\"")
+			}
+		}
+	}
+	methods := opts.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowOrigin := func(origin string) bool {
+		if len(opts.AllowOrigins) == 0 {
+			return true
+		}
+		for _, o := range opts.AllowOrigins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next ErrHandler) ErrHandler {
+		return func(writer http.ResponseWriter, request *http.Request) error {
+			origin := request.Header.Get("Origin")
+			if origin == "" {
+				return next(writer, request)
+			}
+			header := writer.Header()
+			header.Add("Vary", "Origin")
+			preflight := request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != ""
+			if !allowOrigin(origin) {
+				if preflight {
+					return &StatusError{Code: http.StatusForbidden, Message: "origin not allowed"}
+				}
+				return next(writer, request)
+			}
+
+			if len(opts.AllowOrigins) == 0 {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				if len(opts.ExposeHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposeHeaders, ", "))
+				}
+				return next(writer, request)
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(opts.AllowHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowHeaders, ", "))
+			} else if h := request.Header.Get("Access-Control-Request-Headers"); h != "" {
+				header.Set("Access-Control-Allow-Headers", h)
+			}
+			if opts.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+			}
+			writer.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+}
+
+// Mux 在 http.ServeMux 上注册 ErrHandler, 支持 Go 1.22 的 "METHOD /path/{name}" 路由,
+// 路由中的路径参数可由 Bind 的 path tag 读取
+type Mux struct {
+	mux         *http.ServeMux
+	middlewares []Middleware
+}
+
+func NewMux(mw ...Middleware) *Mux {
+	return &Mux{mux: http.NewServeMux(), middlewares: mw}
+}
+
+// Use 添加中间件, 只作用于之后注册的路由
+func (m *Mux) Use(mw ...Middleware) {
+	m.middlewares = append(m.middlewares, mw...)
+}
+
+func (m *Mux) Handle(pattern string, h ErrHandler, mw ...Middleware) {
+	all := make([]Middleware, 0, len(m.middlewares)+len(mw))
+	all = append(append(all, m.middlewares...), mw...)
+	m.mux.Handle(pattern, Chain(all...)(h))
+}
+
+func (m *Mux) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	m.mux.ServeHTTP(writer, request)
+}
@@ -0,0 +1,61 @@
+package http_server_util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	shutdown, exit := context.WithCancel(context.Background())
+	defer exit()
+	wait := ErrHandler(func(writer http.ResponseWriter, request *http.Request) error {
+		<-request.Context().Done()
+		return request.Context().Err()
+	})
+	serve := func(h ErrHandler) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusGatewayTimeout, serve(Timeout(10*time.Millisecond, shutdown)(wait)))
+
+	time.AfterFunc(10*time.Millisecond, exit)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(Timeout(0, shutdown)(wait)))
+	// 退出后不再处理新请求
+	assert.Equal(t, http.StatusServiceUnavailable, serve(Timeout(0, shutdown)(wait)))
+}
+
+func TestCORS(t *testing.T) {
+	assert.Panics(t, func() {
+		CORS(CORSOptions{AllowCredentials: true})
+	})
+	assert.Panics(t, func() {
+		CORS(CORSOptions{AllowCredentials: true, AllowOrigins: []string{"*"}})
+	})
+
+	h := CORS(CORSOptions{AllowCredentials: true, AllowOrigins: []string{"https://a.example.com"}})(func(writer http.ResponseWriter, request *http.Request) error {
+		return nil
+	})
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := preflight("https://a.example.com")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://a.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	rec = preflight("https://b.example.com")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,127 @@
+package http_server_util
+
+import (
+	"context"
+	"github.com/peterq/web-artisan/utils/app"
+	"github.com/pkg/errors"
+	"log"
+	"net"
+	"net/http"
+)
+
+type ServeOptions struct {
+	// 可选, 用于设置超时等参数, 其 Addr 和 Handler 会被覆盖
+	Server *http.Server
+	// 同时设置时使用 https
+	TLSCertFile string
+	TLSKeyFile  string
+	// 非空时在该路径上响应 Readiness / Liveness, 优先于 handler
+	ReadinessPath string
+	LivenessPath  string
+	// 管理 server 生命周期的 Manager, 为 nil 时使用 app.Default()
+	App *app.Manager
+	// 关闭 server 的退出 hook 的选项, 在默认的 app.Priority(ShutdownPriority) 之后应用
+	ShutdownHookOptions []app.HookOption
+}
+
+// 关闭 server 的退出 hook 的默认优先级, 高于默认的 0, 先停止处理请求再关闭数据库等资源
+const ShutdownPriority = 100
+
+// Serve 监听 addr 并在后台运行 server, 监听失败时返回错误.
+// server 注册为 Manager 的 task, Manager 退出时立即停止接受新连接, 并在退出超时内等待处理中的请求完成.
+// server 意外停止时 Manager 退出
+func Serve(addr string, handler http.Handler, opts *ServeOptions) (*http.Server, error) {
+	if opts == nil {
+		opts = &ServeOptions{}
+	}
+	m := opts.App
+	if m == nil {
+		m = app.Default()
+	}
+	srv := opts.Server
+	if srv == nil {
+		srv = &http.Server{}
+	}
+	srv.Addr = addr
+	srv.Handler = withHealthHandlers(handler, opts, m)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen "+addr+" error")
+	}
+
+	hookOpts := append([]app.HookOption{app.HookName("http server " + addr), app.Priority(ShutdownPriority)}, opts.ShutdownHookOptions...)
+	m.OnExitE(func(ctx context.Context) error {
+		return errors.Wrap(srv.Shutdown(ctx), "http server shutdown error")
+	}, hookOpts...)
+
+	taskDone := m.TaskStart("http server " + addr)
+	go func() {
+		var err error
+		if opts.TLSCertFile != "" && opts.TLSKeyFile != "" {
+			err = srv.ServeTLS(ln, opts.TLSCertFile, opts.TLSKeyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		taskDone()
+		if err != nil && err != http.ErrServerClosed && !m.Done() {
+			log.Println("http server stopped unexpectedly:", addr, err)
+			m.Exit()
+		}
+	}()
+	return srv, nil
+}
+
+func withHealthHandlers(handler http.Handler, opts *ServeOptions, m *app.Manager) http.Handler {
+	if opts.ReadinessPath == "" && opts.LivenessPath == "" {
+		return handler
+	}
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	readiness, liveness := Readiness(m.Context()), Liveness()
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		path := request.URL.Path
+		if opts.ReadinessPath != "" && path == opts.ReadinessPath {
+			readiness(writer, request)
+			return
+		}
+		if opts.LivenessPath != "" && path == opts.LivenessPath {
+			liveness(writer, request)
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// Readiness shutdown 结束(一般为 app.Context() 或 Manager.Context())或任一检查失败时响应 503, 否则 200.
+// shutdown 为 nil 时只执行检查
+func Readiness(shutdown context.Context, checks ...func(ctx context.Context) error) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if shutdown != nil && shutdown.Err() != nil {
+			writeHealth(writer, http.StatusServiceUnavailable, "shutting down")
+			return
+		}
+		for _, check := range checks {
+			if err := check(request.Context()); err != nil {
+				writeHealth(writer, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+		}
+		writeHealth(writer, http.StatusOK, "ok")
+	}
+}
+
+// Liveness 进程能处理请求时总是响应 200, 退出中也不失败, 避免退出过程中被重启
+func Liveness() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writeHealth(writer, http.StatusOK, "ok")
+	}
+}
+
+func writeHealth(writer http.ResponseWriter, code int, msg string) {
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(code)
+	_, _ = writer.Write([]byte(msg))
+}
@@ -0,0 +1,83 @@
+package http_server_util
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peterq/web-artisan/utils/app"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	shutdown, exit := context.WithCancel(context.Background())
+	var checkErr error
+	readiness := Readiness(shutdown, func(ctx context.Context) error {
+		return checkErr
+	})
+	liveness := Liveness()
+	code := func(h http.HandlerFunc) int {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, code(readiness))
+	checkErr = errors.New("db down")
+	assert.Equal(t, http.StatusServiceUnavailable, code(readiness))
+	checkErr = nil
+
+	exit()
+	assert.Equal(t, http.StatusServiceUnavailable, code(readiness))
+	// 退出中 liveness 仍然成功
+	assert.Equal(t, http.StatusOK, code(liveness))
+}
+
+func TestServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	exitCode := make(chan int, 1)
+	m := app.New(app.WithTimeout(time.Second), app.WithExitFunc(func(code int) {
+		exitCode <- code
+	}))
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("hello"))
+	})
+	_, err = Serve(addr, handler, &ServeOptions{App: m, ReadinessPath: "/ready", LivenessPath: "/live"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, path := range []string{"/", "/ready", "/live"} {
+		resp, err := client.Get("http://" + addr + path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			_ = resp.Body.Close()
+		}
+	}
+
+	// 默认优先级的 hook 执行时 server 已经关闭
+	var closedFirst bool
+	m.OnExit(func(ctx context.Context) {
+		_, err := client.Get("http://" + addr + "/")
+		closedFirst = err != nil
+	})
+
+	// Manager 退出时关闭 server, 不影响默认的 app
+	m.Exit()
+	assert.Equal(t, 0, <-exitCode)
+	assert.True(t, closedFirst)
+	assert.False(t, app.Done())
+	_, err = client.Get("http://" + addr + "/")
+	assert.Error(t, err)
+}
@@ -0,0 +1,460 @@
+package state_machine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	walFileName      = "wal.jsonl"
+	walRotatedPrefix = "wal-"
+	walRotatedSuffix = ".jsonl"
+)
+
+type PersistOptions struct {
+	// 快照和 WAL 所在目录, 不存在时创建
+	Dir string
+	// 每 SnapshotEvery 个 term 写一次快照, 0 表示不按 term 写
+	SnapshotEvery int64
+	// 状态有变化时每隔 SnapshotInterval 写一次快照, 0 表示不定时写
+	SnapshotInterval time.Duration
+	// 每次状态变化时把新状态追加到 WAL, 崩溃后可以从最后的快照和 WAL 恢复
+	WAL bool
+	// 每次写 WAL 后 fsync
+	SyncWAL bool
+	// 后台写快照或写 WAL 失败时调用, 默认打印日志
+	OnError func(err error)
+}
+
+// 快照文件和 WAL 每行的内容
+type persistedState struct {
+	Term  int64           `json:"term"`
+	State json.RawMessage `json:"state"`
+}
+
+type pendingSnapshot struct {
+	term int64
+	data []byte
+}
+
+// Persister 把 StateMachine 的状态持久化到目录中
+type Persister[T any] struct {
+	m    *StateMachine[T]
+	opts PersistOptions
+
+	// 以下字段由 m.mu 保护
+	wal          *os.File
+	snapshotTerm int64 // 最后一次生成快照时的 term
+	closed       bool
+
+	pending  chan *pendingSnapshot
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	writeMu  sync.Mutex // 串行写快照
+}
+
+// OpenStateMachine 从 opts.Dir 中的快照和 WAL 恢复状态和 term, 没有持久化的状态时使用 state, term 为 1.
+// 返回的 Persister 在状态变化时按 opts 写快照和 WAL, 不再使用时需调用 Close
+func OpenStateMachine[T any](state *T, opts PersistOptions) (*StateMachine[T], *Persister[T], error) {
+	if opts.OnError == nil {
+		opts.OnError = func(err error) {
+			log.Println("state machine persist error:", err)
+		}
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, nil, errors.Wrap(err, "create state dir error")
+	}
+
+	restored, term, err := Restore[T](opts.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := NewStateMachine(state)
+	if restored != nil {
+		*state = *restored
+		m.term = term
+	}
+
+	p := &Persister[T]{
+		m:            m,
+		opts:         opts,
+		snapshotTerm: m.term,
+		pending:      make(chan *pendingSnapshot, 1),
+		stop:         make(chan struct{}),
+	}
+	if opts.WAL {
+		if p.wal, err = openWal(opts.Dir); err != nil {
+			return nil, nil, err
+		}
+	}
+	m.onChange = p.onChange
+
+	p.wg.Add(1)
+	go p.run()
+	return m, p, nil
+}
+
+// Restore 读取 dir 中的快照和 WAL, 返回最新的状态和 term, 没有持久化的状态时返回 nil
+func Restore[T any](dir string) (*T, int64, error) {
+	var latest *persistedState
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, errors.Wrap(err, "read snapshot error")
+	}
+	if err == nil {
+		latest = &persistedState{}
+		if err = json.Unmarshal(data, latest); err != nil {
+			return nil, 0, errors.Wrap(err, "decode snapshot error")
+		}
+	}
+
+	walFiles, err := walFiles(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, name := range walFiles {
+		entries, _, err := readWal(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := range entries {
+			if latest == nil || entries[i].Term > latest.Term {
+				latest = &entries[i]
+			}
+		}
+	}
+
+	if latest == nil {
+		return nil, 0, nil
+	}
+	var state T
+	if err = json.Unmarshal(latest.State, &state); err != nil {
+		return nil, 0, errors.Wrap(err, "decode state error")
+	}
+	return &state, latest.Term, nil
+}
+
+// 轮转后的 WAL 按 term 排序, 当前 WAL 在最后
+func walFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read state dir error")
+	}
+	var rotated []string
+	var current string
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case name == walFileName:
+			current = filepath.Join(dir, name)
+		case strings.HasPrefix(name, walRotatedPrefix) && strings.HasSuffix(name, walRotatedSuffix):
+			rotated = append(rotated, filepath.Join(dir, name))
+		}
+	}
+	// 文件名中的 term 补零到固定长度, 按名称排序即按 term 排序
+	sort.Strings(rotated)
+	if current != "" {
+		rotated = append(rotated, current)
+	}
+	return rotated, nil
+}
+
+// 读取 WAL, 忽略末尾写入中断的一行. 返回 WAL 中的记录和完整的行的总长度
+func readWal(name string) (entries []persistedState, size int64, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "open wal error")
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "read wal error")
+		}
+		size += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var entry persistedState
+		if err = json.Unmarshal(line, &entry); err != nil {
+			return nil, 0, errors.Wrap(err, "decode wal error")
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func openWal(dir string) (*os.File, error) {
+	name := filepath.Join(dir, walFileName)
+	_, size, err := readWal(name)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open wal error")
+	}
+	// 截掉写入中断的最后一行, 避免与新记录连在一起
+	if err = f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "truncate wal error")
+	}
+	return f, nil
+}
+
+// 持有 m.mu 时调用
+func (p *Persister[T]) onChange(state *T, term int64) {
+	if p.closed {
+		return
+	}
+	if p.wal != nil {
+		if err := p.appendWal(state, term); err != nil {
+			p.opts.OnError(err)
+		}
+	}
+	if p.opts.SnapshotEvery > 0 && term-p.snapshotTerm >= p.opts.SnapshotEvery {
+		snap, err := p.capture()
+		if err != nil {
+			p.opts.OnError(err)
+			return
+		}
+		// 只保留最新的待写快照
+		select {
+		case <-p.pending:
+		default:
+		}
+		p.pending <- snap
+	}
+}
+
+func (p *Persister[T]) appendWal(state *T, term int64) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshal state error")
+	}
+	// 与 WaitMarshaledContentChange 共用序列化结果
+	p.m.jsonBin = data
+	line, err := json.Marshal(persistedState{Term: term, State: data})
+	if err != nil {
+		return errors.Wrap(err, "marshal wal entry error")
+	}
+	if _, err = p.wal.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "write wal error")
+	}
+	if p.opts.SyncWAL {
+		if err = p.wal.Sync(); err != nil {
+			return errors.Wrap(err, "sync wal error")
+		}
+	}
+	return nil
+}
+
+// 序列化当前状态并轮转 WAL, 快照写入后轮转出的 WAL 即可删除. 持有 m.mu 时调用
+func (p *Persister[T]) capture() (*pendingSnapshot, error) {
+	state, err := json.Marshal(p.m.state)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal state error")
+	}
+	data, err := json.Marshal(persistedState{Term: p.m.term, State: state})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal snapshot error")
+	}
+	if p.wal != nil {
+		if err = p.rotateWal(p.m.term); err != nil {
+			return nil, err
+		}
+	}
+	p.snapshotTerm = p.m.term
+	return &pendingSnapshot{term: p.m.term, data: data}, nil
+}
+
+// 关闭后总是重新打开 WAL, 轮转失败时继续追加到原来的 WAL. 重新打开也失败时不再写 WAL
+func (p *Persister[T]) rotateWal(term int64) error {
+	var err error
+	if err = p.wal.Close(); err != nil {
+		err = errors.Wrap(err, "close wal error")
+	} else {
+		rotated := filepath.Join(p.opts.Dir, fmt.Sprintf("%s%020d%s", walRotatedPrefix, term, walRotatedSuffix))
+		if err = os.Rename(filepath.Join(p.opts.Dir, walFileName), rotated); err != nil {
+			err = errors.Wrap(err, "rotate wal error")
+		}
+	}
+	wal, openErr := openWal(p.opts.Dir)
+	p.wal = wal
+	if err == nil {
+		err = openErr
+	}
+	return err
+}
+
+func (p *Persister[T]) run() {
+	defer p.wg.Done()
+	var tick <-chan time.Time
+	if p.opts.SnapshotInterval > 0 {
+		ticker := time.NewTicker(p.opts.SnapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case snap := <-p.pending:
+			p.write(snap)
+		case <-tick:
+			if err := p.Snapshot(); err != nil {
+				p.opts.OnError(err)
+			}
+		}
+	}
+}
+
+func (p *Persister[T]) write(snap *pendingSnapshot) {
+	if err := p.writeSnapshot(snap); err != nil {
+		p.opts.OnError(err)
+	}
+}
+
+// Snapshot 状态在上次快照后有变化时立即写快照
+func (p *Persister[T]) Snapshot() error {
+	p.m.mu.Lock()
+	if p.closed || p.m.term <= p.snapshotTerm {
+		p.m.mu.Unlock()
+		return nil
+	}
+	snap, err := p.capture()
+	p.m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.writeSnapshot(snap)
+}
+
+// 写入临时文件后重命名, 替换是原子的
+func (p *Persister[T]) writeSnapshot(snap *pendingSnapshot) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	target := filepath.Join(p.opts.Dir, snapshotFileName)
+	// 之前的快照可能更新, 不能覆盖
+	if data, err := os.ReadFile(target); err == nil {
+		var current persistedState
+		if json.Unmarshal(data, &current) == nil && current.Term >= snap.term {
+			return nil
+		}
+	}
+
+	tmp := target + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create snapshot error")
+	}
+	if _, err = f.Write(snap.data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "write snapshot error")
+	}
+	if err = os.Rename(tmp, target); err != nil {
+		return errors.Wrap(err, "replace snapshot error")
+	}
+	syncDir(p.opts.Dir)
+	return p.removeRotatedWal(snap.term)
+}
+
+// 删除 term 不超过快照的轮转 WAL
+func (p *Persister[T]) removeRotatedWal(term int64) error {
+	entries, err := os.ReadDir(p.opts.Dir)
+	if err != nil {
+		return errors.Wrap(err, "read state dir error")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, walRotatedPrefix) || !strings.HasSuffix(name, walRotatedSuffix) {
+			continue
+		}
+		walTerm, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, walRotatedPrefix), walRotatedSuffix), 10, 64)
+		if err != nil || walTerm > term {
+			continue
+		}
+		if err = os.Remove(filepath.Join(p.opts.Dir, name)); err != nil {
+			return errors.Wrap(err, "remove wal error")
+		}
+	}
+	return nil
+}
+
+// rename 后同步目录, 不支持时忽略
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+// Close 停止后台写快照, 写入最终快照并关闭 WAL. ctx 结束时不再等待, 可以再次调用 Close 继续. 已关闭时什么都不做
+func (p *Persister[T]) Close(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.m.mu.Lock()
+	closed := p.closed
+	p.m.mu.Unlock()
+	if closed {
+		return nil
+	}
+
+	// 写入未写完的和最终的快照
+	select {
+	case snap := <-p.pending:
+		p.write(snap)
+	default:
+	}
+	err := p.Snapshot()
+
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+	p.closed = true
+	if p.wal != nil {
+		if closeErr := p.wal.Close(); err == nil && closeErr != nil {
+			err = errors.Wrap(closeErr, "close wal error")
+		}
+		p.wal = nil
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package state_machine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type counter struct {
+	N int `json:"n"`
+}
+
+func incr(m *StateMachine[counter], times int) {
+	for i := 0; i < times; i++ {
+		m.Update(func(c *counter) bool {
+			c.N++
+			return true
+		})
+	}
+}
+
+func snapshotTerm(t *testing.T, dir string) int64 {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	var s persistedState
+	require.NoError(t, json.Unmarshal(data, &s))
+	return s.Term
+}
+
+func rotatedWal(t *testing.T, dir string) []string {
+	list, err := filepath.Glob(filepath.Join(dir, walRotatedPrefix+"*"+walRotatedSuffix))
+	require.NoError(t, err)
+	return list
+}
+
+func TestPersistSnapshotByTerm(t *testing.T) {
+	dir := t.TempDir()
+	m, p, err := OpenStateMachine(&counter{}, PersistOptions{Dir: dir, SnapshotEvery: 3, WAL: true})
+	require.NoError(t, err)
+
+	incr(m, 2)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(0), snapshotTerm(t, dir))
+
+	incr(m, 1)
+	assert.Eventually(t, func() bool { return snapshotTerm(t, dir) == 4 }, time.Second, 5*time.Millisecond)
+	// 快照写入后删除轮转出的 WAL
+	assert.Eventually(t, func() bool { return len(rotatedWal(t, dir)) == 0 }, time.Second, 5*time.Millisecond)
+
+	incr(m, 1)
+	require.NoError(t, p.Close(context.Background()))
+	require.NoError(t, p.Close(context.Background()))
+	assert.Equal(t, int64(5), snapshotTerm(t, dir))
+
+	// 从快照恢复状态和 term
+	m, p, err = OpenStateMachine(&counter{}, PersistOptions{Dir: dir})
+	require.NoError(t, err)
+	state, term := ReadTerm(m, func(c *counter) counter { return *c })
+	assert.Equal(t, counter{N: 4}, state)
+	assert.Equal(t, int64(5), term)
+	require.NoError(t, p.Close(context.Background()))
+}
+
+func TestPersistSnapshotByTimer(t *testing.T) {
+	dir := t.TempDir()
+	m, p, err := OpenStateMachine(&counter{}, PersistOptions{Dir: dir, SnapshotInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer p.Close(context.Background())
+
+	incr(m, 2)
+	assert.Eventually(t, func() bool { return snapshotTerm(t, dir) == 3 }, time.Second, 5*time.Millisecond)
+}
+
+func TestPersistWalReplay(t *testing.T) {
+	dir := t.TempDir()
+	m, p, err := OpenStateMachine(&counter{}, PersistOptions{Dir: dir, WAL: true, SnapshotEvery: 2})
+	require.NoError(t, err)
+	incr(m, 5)
+
+	// 不调用 Close, 模拟崩溃后从快照和 WAL 恢复
+	state, term, err := Restore[counter](dir)
+	require.NoError(t, err)
+	assert.Equal(t, &counter{N: 5}, state)
+	assert.Equal(t, int64(6), term)
+	require.NoError(t, p.Close(context.Background()))
+}
+
+func TestPersistWalTornTail(t *testing.T) {
+	dir := t.TempDir()
+	wal := filepath.Join(dir, walFileName)
+	require.NoError(t, os.WriteFile(wal, []byte(`{"term":2,"state":{"n":1}}`+"\n"+`{"term":3,"sta`), 0644))
+
+	m, p, err := OpenStateMachine(&counter{}, PersistOptions{Dir: dir, WAL: true})
+	require.NoError(t, err)
+	assert.Equal(t, counter{N: 1}, m.Read(nil))
+	incr(m, 1)
+
+	// 中断的一行被截掉, 新记录可以正常读取
+	entries, _, err := readWal(wal)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(3), entries[1].Term)
+	assert.JSONEq(t, `{"n":2}`, string(entries[1].State))
+	require.NoError(t, p.Close(context.Background()))
+}
+
+func TestPersistRotateFailure(t *testing.T) {
+	dir := t.TempDir()
+	m, p, err := OpenStateMachine(&counter{}, PersistOptions{Dir: dir, WAL: true})
+	require.NoError(t, err)
+	defer p.Close(context.Background())
+	incr(m, 1)
+
+	// 轮转失败后 WAL 仍然可以写入
+	require.NoError(t, os.Remove(filepath.Join(dir, walFileName)))
+	assert.Error(t, p.Snapshot())
+	incr(m, 1)
+
+	entries, _, err := readWal(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(3), entries[0].Term)
+}
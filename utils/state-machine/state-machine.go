@@ -31,6 +31,8 @@ type StateMachine[T any] struct {
 	mu         sync.Mutex // guards
 	changeCond cond_chan.Cond
 	waitingCnt int
+	// 状态变化后在持有 mu 时调用, 用于持久化
+	onChange func(state *T, term int64)
 }
 
 func (m *StateMachine[T]) Update(fn func(*T) bool) {
@@ -54,6 +56,9 @@ func Update[T any](m *StateMachine[T], fn func(*T) bool) int64 {
 		m.yamlNode = nil
 		m.yamlBin = nil
 		m.jsonBin = nil
+		if m.onChange != nil {
+			m.onChange(m.state, m.term)
+		}
 		if m.waitingCnt == 1 {
 			m.changeCond.Signal()
 		} else if m.waitingCnt > 1 {